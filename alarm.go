@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// eventApproaching is the kind of the alarm raised shortly before arriving at
+// a watched stop.
+const eventApproaching = "approaching"
+
+// alarm is an event at a watched stop that users are notified about. Next to
+// the event itself it carries the state of the stop when the alarm was raised.
+type alarm struct {
+	event
+	Distance     float64 `json:"distance_km"`
+	ETAMinutes   float64 `json:"eta_minutes"`
+	DelayMinutes float64 `json:"delay_minutes"`
+	Platform     string  `json:"platform"`
+}
+
+// alarms is a sink raising alarms for the stops selected with -destination:
+// once when the train is about to arrive, and whenever the platform or, by at
+// least delayThreshold, the delay changes. Connections becoming at risk and
+// destinations being cancelled, as detected by eventDetector, raise alarms,
+// too.
+type alarms struct {
+	// before and distance trigger the arrival alarm when the stop is at most
+	// this far away in time or kilometers. Zero disables the trigger.
+	before   time.Duration
+	distance float64
+
+	delayThreshold time.Duration
+	notifiers      []notifier
+
+	lastID      int
+	approaching map[string]bool
+	platforms   map[string]string
+	delays      map[string]time.Duration
+}
+
+func newAlarms(before time.Duration, distance float64, delayThreshold time.Duration, notifiers []notifier) *alarms {
+	return &alarms{
+		before:         before,
+		distance:       distance,
+		delayThreshold: delayThreshold,
+		notifiers:      notifiers,
+		approaching:    make(map[string]bool),
+		platforms:      make(map[string]string),
+		delays:         make(map[string]time.Duration),
+	}
+}
+
+func (a *alarms) update(u *update) error {
+	if u.tripChanged() {
+		a.approaching = make(map[string]bool)
+		a.platforms = make(map[string]string)
+		a.delays = make(map[string]time.Duration)
+	}
+	if u.Trip == nil {
+		return nil
+	}
+	trip := u.Trip
+
+	var firstErr error
+	notify := func(al *alarm) {
+		for _, n := range a.notifiers {
+			if err := n.notify(al); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	raise := func(kind string, stop *bahn.Stop, msg string, old, new string) {
+		a.lastID++
+		al := alarm{
+			event: event{
+				ID:      a.lastID,
+				Time:    u.Time,
+				Kind:    kind,
+				Train:   tripName(trip),
+				EvaNr:   stop.Station.ID,
+				Station: stop.Station.Name,
+				Message: msg,
+				Old:     old,
+				New:     new,
+			},
+			Distance:     trip.DistanceTo(stop),
+			DelayMinutes: stop.Delay().Minutes(),
+			Platform:     stop.Platform,
+		}
+		if bahn.ValidTime(stop.ActualArrival) {
+			al.ETAMinutes = etaAt(stop, u.Time).Minutes()
+		}
+		notify(&al)
+	}
+
+	for _, e := range u.Events {
+		switch e.Kind {
+		case eventConnectionRisk:
+			if stop := stopByID(trip, e.EvaNr); stop != nil {
+				raise(e.Kind, stop, e.Message, e.Old, e.New)
+			}
+		case eventStopCancelled:
+			// The stop may no longer be part of the trip.
+			a.lastID++
+			e.ID = a.lastID
+			notify(&alarm{event: e})
+		}
+	}
+
+	stops, err := findDestinations(trip)
+	if err != nil {
+		// Already reported by printUpdate.
+		return firstErr
+	}
+
+	for _, stop := range stops {
+		if stop.Passed || stop.Status == bahn.StopCancelled {
+			// Cancellations are reported by eventDetector.
+			continue
+		}
+		id := stop.Station.ID
+
+		if !a.approaching[id] && a.isApproaching(u.Time, trip, stop) {
+			a.approaching[id] = true
+			raise(eventApproaching, stop, fmt.Sprintf("arriving at %s on platform %s in %s (%.1f km)",
+				stop.Station, stop.Platform, formatDuration(stop.ActualArrival.Sub(u.Time)), trip.DistanceTo(stop)), "", "")
+		}
+
+		if old, ok := a.platforms[id]; ok && old != stop.Platform {
+			raise(eventPlatformChanged, stop,
+				fmt.Sprintf("platform at %s changed from %s to %s", stop.Station, old, stop.Platform),
+				old, stop.Platform)
+		}
+		a.platforms[id] = stop.Platform
+
+		d := stop.Delay()
+		if old, ok := a.delays[id]; !ok {
+			a.delays[id] = d
+		} else if math.Abs(float64(d-old)) >= float64(a.delayThreshold) && d != old {
+			raise(eventDelayChanged, stop,
+				fmt.Sprintf("delay at %s changed from %s to %s", stop.Station, formatDelay(old), formatDelay(d)),
+				fmt.Sprintf("%.0f", old.Minutes()), fmt.Sprintf("%.0f", d.Minutes()))
+			a.delays[id] = d
+		}
+	}
+
+	return firstErr
+}
+
+// isApproaching returns true if the train is within the configured time or
+// distance of stop.
+func (a *alarms) isApproaching(t time.Time, trip *bahn.Trip, stop *bahn.Stop) bool {
+	if a.before > 0 && bahn.ValidTime(stop.ActualArrival) && stop.ActualArrival.Sub(t) <= a.before {
+		return true
+	}
+	return a.distance > 0 && trip.DistanceTo(stop) <= a.distance
+}
+
+func (a *alarms) close() error {
+	return nil
+}
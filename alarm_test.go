@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// recordingNotifier records the alarms it is notified about.
+type recordingNotifier struct {
+	alarms []alarm
+}
+
+func (n *recordingNotifier) notify(a *alarm) error {
+	n.alarms = append(n.alarms, *a)
+	return nil
+}
+
+// kinds returns the kinds of the recorded alarms and forgets them.
+func (n *recordingNotifier) kinds() []string {
+	var kinds []string
+	for _, a := range n.alarms {
+		kinds = append(kinds, a.Kind)
+	}
+	n.alarms = nil
+	return kinds
+}
+
+// alarmTestTime is the scheduled arrival at the destination of alarmTrip.
+var alarmTestTime = time.Date(2018, 8, 2, 21, 0, 0, 0, time.UTC)
+
+// alarmTrip returns a trip from Köln Hbf to Frankfurt Airport, 145 km away,
+// with the train the given distance past Köln Hbf.
+func alarmTrip(distance float64, platform string, delay time.Duration) *bahn.Trip {
+	koeln := &bahn.Stop{
+		Station: &bahn.Station{ID: "8000207_00", Name: "Köln Hbf"},
+		Passed:  true,
+	}
+	frankfurt := &bahn.Stop{
+		Station:           &bahn.Station{ID: "8070003_00", Name: "Frankfurt (M) Flughafen Fernbf"},
+		Platform:          platform,
+		DistanceFromStart: 145,
+		ScheduledArrival:  alarmTestTime,
+		ActualArrival:     alarmTestTime.Add(delay),
+	}
+	return &bahn.Trip{
+		TrainType:            "ICE",
+		TrainID:              "521",
+		DistanceFromLastStop: distance,
+		PreviousStop:         koeln,
+		NextStop:             frankfurt,
+		Stops:                []*bahn.Stop{koeln, frankfurt},
+	}
+}
+
+// checkKinds reports an error if got and want differ.
+func checkKinds(t *testing.T, step string, got []string, want ...string) {
+	if len(got) != len(want) {
+		t.Errorf("%s: alarms %q, want %q", step, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: alarms %q, want %q", step, got, want)
+			return
+		}
+	}
+}
+
+func TestAlarmApproachingByTime(t *testing.T) {
+	n := &recordingNotifier{}
+	a := newAlarms(10*time.Minute, 0, 5*time.Minute, []notifier{n})
+
+	a.update(&update{Time: alarmTestTime.Add(-30 * time.Minute), Trip: alarmTrip(50, "5", 0)})
+	checkKinds(t, "30 min before", n.kinds())
+
+	a.update(&update{Time: alarmTestTime.Add(-9 * time.Minute), Trip: alarmTrip(130, "5", 0)})
+	if len(n.alarms) == 1 {
+		// The ETA is relative to the update, not to the current time.
+		if al := n.alarms[0]; al.ETAMinutes != 9 || al.Distance != 15 || al.Platform != "5" {
+			t.Errorf("alarm = %+v, want ETA 9 min, distance 15 km, platform 5", al)
+		}
+	}
+	checkKinds(t, "9 min before", n.kinds(), eventApproaching)
+
+	// The alarm is raised only once.
+	a.update(&update{Time: alarmTestTime.Add(-8 * time.Minute), Trip: alarmTrip(135, "5", 0)})
+	checkKinds(t, "8 min before", n.kinds())
+
+	// A new trip starts over.
+	a.update(&update{
+		Time:   alarmTestTime.Add(-7 * time.Minute),
+		Trip:   alarmTrip(140, "5", 0),
+		Events: []event{{Kind: eventTripChanged}},
+	})
+	checkKinds(t, "new trip", n.kinds(), eventApproaching)
+}
+
+func TestAlarmApproachingByDistance(t *testing.T) {
+	n := &recordingNotifier{}
+	a := newAlarms(0, 5, 5*time.Minute, []notifier{n})
+
+	for _, c := range []struct {
+		distance float64
+		want     []string
+	}{
+		{130, nil},
+		{140, []string{eventApproaching}},
+		{142, nil},
+	} {
+		a.update(&update{Time: alarmTestTime.Add(-time.Hour), Trip: alarmTrip(c.distance, "5", 0)})
+		checkKinds(t, fmt.Sprintf("%g km from the stop", 145-c.distance), n.kinds(), c.want...)
+	}
+}
+
+func TestAlarmChanges(t *testing.T) {
+	n := &recordingNotifier{}
+	a := newAlarms(0, 0, 5*time.Minute, []notifier{n})
+
+	cases := []struct {
+		step     string
+		platform string
+		delay    time.Duration
+		events   []event
+		want     []string
+	}{
+		{"first update", "5", 0, nil, nil},
+		{"platform changed", "7", 0, nil, []string{eventPlatformChanged}},
+		{"below threshold", "7", 3 * time.Minute, nil, nil},
+		// The change is compared with the last alarm, not the last update.
+		{"threshold reached", "7", 6 * time.Minute, nil, []string{eventDelayChanged}},
+		{"small increase", "7", 8 * time.Minute, nil, nil},
+		{"delay reduced", "7", time.Minute, nil, []string{eventDelayChanged}},
+		{"both changed", "5", 10 * time.Minute, nil, []string{eventPlatformChanged, eventDelayChanged}},
+		// A new trip is first seen on platform 7 without being a change.
+		{"new trip", "7", 0, []event{{Kind: eventTripChanged}}, nil},
+	}
+	for _, c := range cases {
+		a.update(&update{Time: alarmTestTime.Add(-time.Hour), Trip: alarmTrip(10, c.platform, c.delay), Events: c.events})
+		alarms := n.alarms
+		checkKinds(t, c.step, n.kinds(), c.want...)
+
+		if c.step == "platform changed" && len(alarms) == 1 {
+			if al := alarms[0]; al.Old != "5" || al.New != "7" || al.EvaNr != "8070003_00" {
+				t.Errorf("%s: alarm = %+v, want platform 5 to 7 at 8070003_00", c.step, al)
+			}
+		}
+		if c.step == "threshold reached" && len(alarms) == 1 {
+			if al := alarms[0]; al.Old != "0" || al.New != "6" || al.DelayMinutes != 6 {
+				t.Errorf("%s: alarm = %+v, want delay 0 to 6 min", c.step, al)
+			}
+		}
+	}
+}
+
+func TestAlarmEvents(t *testing.T) {
+	n := &recordingNotifier{}
+	a := newAlarms(0, 0, 5*time.Minute, []notifier{n})
+
+	a.update(&update{
+		Time: alarmTestTime.Add(-time.Hour),
+		Trip: alarmTrip(10, "5", 0),
+		Events: []event{
+			{Kind: eventConnectionRisk, EvaNr: "8070003_00", Message: "connection at risk"},
+			{Kind: eventStopCancelled, EvaNr: "8000105_00", Station: "Frankfurt (Main) Hbf"},
+			{Kind: eventDeparted, EvaNr: "8000207_00"},
+		},
+	})
+
+	if len(n.alarms) == 2 && n.alarms[1].ID != 2 {
+		t.Errorf("second alarm has ID %d, want 2", n.alarms[1].ID)
+	}
+	checkKinds(t, "events", n.kinds(), eventConnectionRisk, eventStopCancelled)
+}
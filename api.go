@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// The types in this file are the representations of the bahn types served by
+// the /v1 API. Distances are in kilometers, speeds in km/h, durations in
+// seconds and timestamps in ISO-8601 format. Timestamps the portal didn't
+// provide are omitted.
+
+type apiStatus struct {
+	Time         time.Time `json:"time"`
+	Received     time.Time `json:"received"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	Connection   bool      `json:"connection"`
+	ServiceLevel string    `json:"service_level"`
+	Speed        float64   `json:"speed_kmh"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+
+	// The following fields are derived from the position and the trip.
+	NearestStop          string   `json:"nearest_stop,omitempty"`
+	NearestStopDistance  float64  `json:"nearest_stop_distance_km,omitempty"`
+	GPSDistanceFromStart *float64 `json:"gps_distance_from_start_km,omitempty"`
+	DistanceDeviation    *float64 `json:"distance_deviation_km,omitempty"`
+}
+
+type apiStop struct {
+	EvaNr              string     `json:"eva_nr"`
+	Name               string     `json:"name"`
+	Status             string     `json:"status"`
+	Latitude           float64    `json:"latitude"`
+	Longitude          float64    `json:"longitude"`
+	Platform           string     `json:"platform"`
+	Passed             bool       `json:"passed"`
+	DistanceFromStart  float64    `json:"distance_from_start_km"`
+	Distance           float64    `json:"distance_km"`
+	ScheduledArrival   *time.Time `json:"scheduled_arrival,omitempty"`
+	ActualArrival      *time.Time `json:"actual_arrival,omitempty"`
+	ScheduledDeparture *time.Time `json:"scheduled_departure,omitempty"`
+	ActualDeparture    *time.Time `json:"actual_departure,omitempty"`
+	DelaySeconds       float64    `json:"delay_seconds"`
+	ETASeconds         float64    `json:"eta_seconds"`
+}
+
+type apiTrip struct {
+	Train             string    `json:"train"`
+	TrainType         string    `json:"train_type"`
+	TrainID           string    `json:"train_id"`
+	Date              string    `json:"date"`
+	Received          time.Time `json:"received"`
+	AgeSeconds        float64   `json:"age_seconds"`
+	DistanceFromStart float64   `json:"distance_from_start_km"`
+	TotalDistance     float64   `json:"total_distance_km"`
+	RemainingDistance float64   `json:"remaining_distance_km"`
+	PreviousStop      string    `json:"previous_stop,omitempty"`
+	NextStop          string    `json:"next_stop,omitempty"`
+	Stops             []apiStop `json:"stops"`
+}
+
+// apiPosition is the estimated position of the train. Unlike apiStatus, it is
+// interpolated between polls.
+type apiPosition struct {
+	Time               time.Time `json:"time"`
+	Latitude           float64   `json:"latitude"`
+	Longitude          float64   `json:"longitude"`
+	Speed              float64   `json:"speed_kmh"`
+	DistanceFromStart  float64   `json:"distance_from_start_km"`
+	NextStop           string    `json:"next_stop,omitempty"`
+	NextStopDistance   float64   `json:"next_stop_distance_km"`
+	NextStopETASeconds float64   `json:"next_stop_eta_seconds"`
+}
+
+func apiTime(t time.Time) *time.Time {
+	if !bahn.ValidTime(t) {
+		return nil
+	}
+	return &t
+}
+
+// newAPIStop converts stop. The ETA is relative to now.
+func newAPIStop(trip *bahn.Trip, stop *bahn.Stop, now time.Time) apiStop {
+	s := apiStop{
+		EvaNr:              stop.Station.ID,
+		Name:               stop.Station.Name,
+		Status:             stop.Status.String(),
+		Latitude:           stop.Station.Latitude,
+		Longitude:          stop.Station.Longitude,
+		Platform:           stop.Platform,
+		Passed:             stop.Passed,
+		DistanceFromStart:  stop.DistanceFromStart,
+		ScheduledArrival:   apiTime(stop.ScheduledArrival),
+		ActualArrival:      apiTime(stop.ActualArrival),
+		ScheduledDeparture: apiTime(stop.ScheduledDeparture),
+		ActualDeparture:    apiTime(stop.ActualDeparture),
+		DelaySeconds:       stop.Delay().Seconds(),
+	}
+
+	if !stop.Passed {
+		s.Distance = trip.DistanceTo(stop)
+		if bahn.ValidTime(stop.ActualArrival) {
+			s.ETASeconds = etaAt(stop, now).Seconds()
+		}
+	}
+
+	return s
+}
+
+// newAPITrip converts trip, which was received at the given time. The age and
+// ETAs are relative to now.
+func newAPITrip(trip *bahn.Trip, received, now time.Time) *apiTrip {
+	t := &apiTrip{
+		Train:             tripName(trip),
+		TrainType:         trip.TrainType,
+		TrainID:           trip.TrainID,
+		Date:              trip.Date.Format("2006-01-02"),
+		Received:          received,
+		AgeSeconds:        now.Sub(received).Seconds(),
+		DistanceFromStart: trip.DistanceFromStart(),
+		TotalDistance:     trip.TotalDistance,
+		RemainingDistance: trip.TotalDistance - trip.DistanceFromStart(),
+		Stops:             []apiStop{},
+	}
+
+	if trip.PreviousStop != nil {
+		t.PreviousStop = trip.PreviousStop.Station.ID
+	}
+	if trip.NextStop != nil {
+		t.NextStop = trip.NextStop.Station.ID
+	}
+
+	for _, stop := range trip.Stops {
+		t.Stops = append(t.Stops, newAPIStop(trip, stop, now))
+	}
+
+	return t
+}
+
+// newAPIStatus converts s, which was received at the given time. The age is
+// relative to now. If trip is not nil, the position is related to the trip's
+// stops.
+func newAPIStatus(s *bahn.Status, received, now time.Time, trip *bahn.Trip) *apiStatus {
+	st := &apiStatus{
+		Time:         s.ServerTime,
+		Received:     received,
+		AgeSeconds:   now.Sub(received).Seconds(),
+		Connection:   s.Connection,
+		ServiceLevel: s.ServiceLevel,
+		Speed:        s.Speed,
+		Latitude:     s.Latitude,
+		Longitude:    s.Longitude,
+	}
+
+	if trip == nil || s.Position().IsZero() {
+		return st
+	}
+
+	if stop, dist := trip.NearestStop(s.Position()); stop != nil {
+		st.NearestStop = stop.Station.ID
+		st.NearestStopDistance = dist
+	}
+	if c, ok := trip.CheckDistance(s.Position()); ok {
+		gps, dev := c.GPS, c.Deviation()
+		st.GPSDistanceFromStart = &gps
+		st.DistanceDeviation = &dev
+	}
+
+	return st
+}
+
+// writeAPIResponse writes v as JSON. If v is nil, i.e. no data has been
+// received from the portal yet, a 503 error is returned instead.
+func writeAPIResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if v == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		v = map[string]string{"error": "no data received from the portal yet"}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// handleAPITrip serves /v1/trip.
+func (s *server) handleAPITrip(w http.ResponseWriter, r *http.Request) {
+	s.state.mu.RLock()
+	trip, received, now := s.state.trip, s.state.tripTime, s.state.now
+	s.state.mu.RUnlock()
+
+	if trip == nil {
+		writeAPIResponse(w, nil)
+		return
+	}
+	writeAPIResponse(w, newAPITrip(trip, received, now))
+}
+
+// handleAPIStatus serves /v1/status.
+func (s *server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	s.state.mu.RLock()
+	status, received, trip, now := s.state.status, s.state.statusTime, s.state.trip, s.state.now
+	s.state.mu.RUnlock()
+
+	if status == nil {
+		writeAPIResponse(w, nil)
+		return
+	}
+	writeAPIResponse(w, newAPIStatus(status, received, now, trip))
+}
+
+// handleAPIPosition serves /v1/position.
+func (s *server) handleAPIPosition(w http.ResponseWriter, r *http.Request) {
+	if p := s.state.estimate(time.Now()); p != nil {
+		writeAPIResponse(w, p)
+		return
+	}
+	writeAPIResponse(w, nil)
+}
+
+// handleAPIStop serves /v1/stops/{evaNr}. The EVA number may be specified
+// with or without the "_00" suffix used by the portal.
+func (s *server) handleAPIStop(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/stops/")
+
+	s.state.mu.RLock()
+	trip, now := s.state.trip, s.state.now
+	s.state.mu.RUnlock()
+
+	if trip == nil {
+		writeAPIResponse(w, nil)
+		return
+	}
+
+	for _, stop := range trip.Stops {
+		if stop.Station.ID == id || stop.Station.EvaNr() == id {
+			writeAPIResponse(w, newAPIStop(trip, stop, now))
+			return
+		}
+	}
+
+	writeAPIError(w, http.StatusNotFound, "no stop with EVA number "+strconv.Quote(id))
+}
+
+// handleAPIEvents serves /v1/events. The optional "since" parameter limits
+// the response to events with a greater ID.
+func (s *server) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	var since int
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = strconv.Atoi(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid \"since\" parameter")
+			return
+		}
+	}
+
+	s.state.mu.RLock()
+	events := []event{}
+	for _, e := range s.state.events {
+		if e.ID > since {
+			events = append(events, e)
+		}
+	}
+	s.state.mu.RUnlock()
+
+	writeAPIResponse(w, events)
+}
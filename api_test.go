@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// apiTestTime is the time the test server received the trip and status.
+var apiTestTime = time.Date(2018, 8, 2, 20, 10, 0, 0, time.UTC)
+
+// newAPITestServer returns a server that received a trip of ICE 521 and a
+// status at apiTestTime, two events and, 30 seconds later, a failed poll.
+func newAPITestServer() *server {
+	siegburg := &bahn.Stop{
+		Station:           &bahn.Station{ID: "8005556_00", Name: "Siegburg/Bonn"},
+		DistanceFromStart: 25,
+		ScheduledArrival:  apiTestTime.Add(10 * time.Minute),
+		ActualArrival:     apiTestTime.Add(12 * time.Minute),
+	}
+	koeln := &bahn.Stop{
+		Station:            &bahn.Station{ID: "8000207_00", Name: "Köln Hbf"},
+		Passed:             true,
+		ScheduledArrival:   apiTestTime.Add(-10 * time.Minute),
+		ActualArrival:      apiTestTime.Add(-8 * time.Minute),
+		ScheduledDeparture: apiTestTime.Add(-8 * time.Minute),
+		ActualDeparture:    apiTestTime.Add(-6 * time.Minute),
+	}
+	trip := &bahn.Trip{
+		TrainType:            "ICE",
+		TrainID:              "521",
+		Date:                 apiTestTime,
+		TotalDistance:        25,
+		DistanceFromLastStop: 5,
+		PreviousStop:         koeln,
+		NextStop:             siegburg,
+		Stops:                []*bahn.Stop{koeln, siegburg},
+	}
+
+	s := newServer("localhost:0")
+	s.update(&update{
+		Time:   apiTestTime,
+		Trip:   trip,
+		Status: &bahn.Status{Speed: 160, Connection: true},
+		Events: []event{
+			{ID: 1, Kind: eventDeparted, Station: "Köln Hbf"},
+			{ID: 2, Kind: eventDelayChanged, Station: "Siegburg/Bonn"},
+		},
+	})
+	err := errors.New("portal unreachable")
+	s.update(&update{Time: apiTestTime.Add(30 * time.Second), TripErr: err, StatusErr: err})
+	return s
+}
+
+// getAPI requests path from s and decodes the JSON response into v.
+func getAPI(t *testing.T, s *server, path string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("GET %s: Content-Type = %q, want %q", path, got, want)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: json.Unmarshal(%q) = %v", path, rec.Body.Bytes(), err)
+	}
+	return rec.Code
+}
+
+func TestAPINoData(t *testing.T) {
+	s := newServer("localhost:0")
+	for _, path := range []string{"/v1/trip", "/v1/status", "/v1/stops/8000207"} {
+		var res map[string]string
+		if code := getAPI(t, s, path, &res); code != http.StatusServiceUnavailable || res["error"] == "" {
+			t.Errorf("GET %s = %d %v, want %d and an error", path, code, res, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestAPITrip(t *testing.T) {
+	var trip apiTrip
+	if code := getAPI(t, newAPITestServer(), "/v1/trip", &trip); code != http.StatusOK {
+		t.Fatalf("GET /v1/trip = %d, want %d", code, http.StatusOK)
+	}
+
+	if trip.Train != "ICE 521" || trip.Date != "2018-08-02" {
+		t.Errorf("train = %q on %s, want %q on 2018-08-02", trip.Train, trip.Date, "ICE 521")
+	}
+	// The age is relative to the last update, not to the current time.
+	if trip.AgeSeconds != 30 {
+		t.Errorf("age_seconds = %g, want 30", trip.AgeSeconds)
+	}
+	if trip.PreviousStop != "8000207_00" || trip.NextStop != "8005556_00" {
+		t.Errorf("previous_stop, next_stop = %q, %q, want %q, %q", trip.PreviousStop, trip.NextStop, "8000207_00", "8005556_00")
+	}
+	if trip.RemainingDistance != 20 {
+		t.Errorf("remaining_distance_km = %g, want 20", trip.RemainingDistance)
+	}
+
+	if len(trip.Stops) != 2 {
+		t.Fatalf("got %d stops, want 2", len(trip.Stops))
+	}
+	if s := trip.Stops[0]; !s.Passed || s.ETASeconds != 0 || s.DelaySeconds != 120 {
+		t.Errorf("stops[0] = %+v, want passed with a delay of 120 s and no ETA", s)
+	}
+	// The train arrives 12 minutes after the trip was received.
+	if s := trip.Stops[1]; s.ETASeconds != 690 || s.Distance != 20 || s.ScheduledDeparture != nil {
+		t.Errorf("stops[1] = %+v, want ETA 690 s, distance 20 km and no departure", s)
+	}
+}
+
+func TestAPIStatus(t *testing.T) {
+	var st apiStatus
+	if code := getAPI(t, newAPITestServer(), "/v1/status", &st); code != http.StatusOK {
+		t.Fatalf("GET /v1/status = %d, want %d", code, http.StatusOK)
+	}
+
+	if st.Speed != 160 || !st.Connection {
+		t.Errorf("speed, connection = %g, %v, want 160, true", st.Speed, st.Connection)
+	}
+	if !st.Received.Equal(apiTestTime) || st.AgeSeconds != 30 {
+		t.Errorf("received, age = %v, %g, want %v, 30", st.Received, st.AgeSeconds, apiTestTime)
+	}
+}
+
+func TestAPIStop(t *testing.T) {
+	s := newAPITestServer()
+
+	for _, path := range []string{"/v1/stops/8005556", "/v1/stops/8005556_00"} {
+		var stop apiStop
+		if code := getAPI(t, s, path, &stop); code != http.StatusOK {
+			t.Errorf("GET %s = %d, want %d", path, code, http.StatusOK)
+			continue
+		}
+		if stop.Name != "Siegburg/Bonn" || stop.ETASeconds != 690 {
+			t.Errorf("GET %s = %+v, want Siegburg/Bonn with ETA 690 s", path, stop)
+		}
+	}
+
+	var res map[string]string
+	if code := getAPI(t, s, "/v1/stops/8000105", &res); code != http.StatusNotFound || res["error"] == "" {
+		t.Errorf("GET /v1/stops/8000105 = %d %v, want %d and an error", code, res, http.StatusNotFound)
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	s := newAPITestServer()
+
+	cases := []struct {
+		query string
+		ids   []int
+	}{
+		{"", []int{1, 2}},
+		{"?since=0", []int{1, 2}},
+		{"?since=1", []int{2}},
+		{"?since=2", []int{}},
+	}
+	for _, c := range cases {
+		var events []event
+		if code := getAPI(t, s, "/v1/events"+c.query, &events); code != http.StatusOK {
+			t.Errorf("GET /v1/events%s = %d, want %d", c.query, code, http.StatusOK)
+			continue
+		}
+		ids := []int{}
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		if !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("GET /v1/events%s returned events %v, want %v", c.query, ids, c.ids)
+		}
+	}
+
+	var res map[string]string
+	if code := getAPI(t, s, "/v1/events?since=yesterday", &res); code != http.StatusBadRequest {
+		t.Errorf("GET /v1/events?since=yesterday = %d, want %d", code, http.StatusBadRequest)
+	}
+}
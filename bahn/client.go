@@ -0,0 +1,136 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// DefaultBaseURL is the base URL of the ICE portal.
+const DefaultBaseURL = "https://iceportal.de"
+
+// Paths of the portal's API endpoints, relative to the base URL.
+const (
+	StatusPath   = "/api1/rs/status"
+	TripInfoPath = "/api1/rs/tripInfo/trip"
+)
+
+// Client queries the portal's API. The zero value is usable and queries
+// DefaultBaseURL using http.DefaultClient.
+type Client struct {
+	// BaseURL is the URL the API paths are appended to. Set this to use a
+	// caching proxy instead of the portal.
+	BaseURL string
+
+	// HTTPClient is the client used to make requests.
+	HTTPClient *http.Client
+
+	// Retry is the policy for retrying failed requests. If nil, requests
+	// are not retried.
+	Retry *RetryPolicy
+}
+
+// DefaultClient is the client used by StatusInfo and TripInfo.
+var DefaultClient = &Client{}
+
+// HTTPError is returned when the portal responds with a non-2xx status code.
+type HTTPError struct {
+	// Method is the request's method. If empty, GET is assumed.
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	method := e.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return fmt.Sprintf("%s %s: %s", method, e.URL, e.Status)
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return c.BaseURL
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// Get requests path, e.g. StatusPath, and returns the raw response body.
+// Failed requests are retried according to c.Retry.
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	var body []byte
+	err := c.Retry.Do(ctx, func() error {
+		var err error
+		body, err = c.get(ctx, path)
+		return err
+	})
+
+	return body, err
+}
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	url := c.baseURL() + path
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &HTTPError{
+			URL:        url,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// Status calls the status API and returns the parsed data.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	b, err := c.Get(ctx, StatusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Status
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Trip calls the tripInfo API and returns the parsed data.
+func (c *Client) Trip(ctx context.Context) (*Trip, error) {
+	b, err := c.Get(ctx, TripInfoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Trip
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,76 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const statusStr = `{
+  "connection": true,
+  "serviceLevel": "AVAILABLE_SERVICE",
+  "speed": 247.0,
+  "latitude": 49.123456,
+  "longitude": 11.234567,
+  "serverTime": 1533191000000
+}`
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatusPath, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, statusStr)
+	})
+	mux.HandleFunc(TripInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, inputStr)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	c := &Client{
+		BaseURL: srv.URL,
+	}
+	ctx := context.Background()
+
+	s, err := c.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if got, want := s.Speed, 247.0; got != want {
+		t.Errorf("s.Speed = %g, want %g", got, want)
+	}
+	if got, want := s.ServerTime, time.Unix(1533191000, 0); !got.Equal(want) {
+		t.Errorf("s.ServerTime = %v, want %v", got, want)
+	}
+
+	trip, err := c.Trip(ctx)
+	if err != nil {
+		t.Fatalf("Trip() = %v", err)
+	}
+	if got, want := trip.TrainID, "521"; got != want {
+		t.Errorf("trip.TrainID = %q, want %q", got, want)
+	}
+}
+
+func TestClientHTTPError(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	c := &Client{
+		BaseURL: srv.URL,
+	}
+
+	_, err := c.Get(context.Background(), "/does/not/exist")
+	httpErr, ok := err.(*HTTPError)
+	if !ok {
+		t.Fatalf("Get() = %v, want *HTTPError", err)
+	}
+	if got, want := httpErr.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("httpErr.StatusCode = %d, want %d", got, want)
+	}
+}
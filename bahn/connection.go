@@ -0,0 +1,123 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Connection is an onward train at a stop of the trip, as provided by the
+// portal when the passenger selected a connection.
+type Connection struct {
+	TrainType          string
+	TrainID            string
+	Station            *Station
+	Platform           string
+	ScheduledDeparture time.Time
+	ActualDeparture    time.Time
+	// Conflict is the portal's assessment of the connection, e.g.
+	// "NO_CONFLICT". It is empty if unknown.
+	Conflict string
+}
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface.
+func (c *Connection) UnmarshalJSON(b []byte) error {
+	var parsed struct {
+		TrainType string
+		VZN       string
+		Station   *Station
+		Track     struct {
+			Actual, Scheduled string
+		}
+		Timetable struct {
+			ScheduledDepartureTime int
+			ActualDepartureTime    int
+		}
+	}
+
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+
+	*c = Connection{
+		TrainType:          parsed.TrainType,
+		TrainID:            parsed.VZN,
+		Station:            parsed.Station,
+		Platform:           parsed.Track.Scheduled,
+		ScheduledDeparture: time.Unix(int64(parsed.Timetable.ScheduledDepartureTime/1000), 0),
+		ActualDeparture:    time.Unix(int64(parsed.Timetable.ActualDepartureTime/1000), 0),
+	}
+
+	if parsed.Track.Actual != "" {
+		c.Platform = parsed.Track.Actual
+	}
+	if parsed.Timetable.ActualDepartureTime == 0 {
+		c.ActualDeparture = c.ScheduledDeparture
+	}
+
+	return nil
+}
+
+// TransferRisk classifies how likely a transfer is to succeed.
+type TransferRisk int
+
+// Transfer risks, in order of increasing severity.
+const (
+	TransferOK TransferRisk = iota
+	TransferTight
+	TransferMissed
+)
+
+func (r TransferRisk) String() string {
+	switch r {
+	case TransferOK:
+		return "ok"
+	case TransferTight:
+		return "tight"
+	case TransferMissed:
+		return "missed"
+	}
+	return "unknown"
+}
+
+// Transfer is a change from a stop of the trip to an onward departure.
+type Transfer struct {
+	Stop      *Stop
+	Departure time.Time
+}
+
+// Buffer returns the time between the expected arrival at the stop and the
+// departure. It is negative if the train is expected to arrive after the
+// departure.
+func (tr Transfer) Buffer() time.Duration {
+	return tr.Departure.Sub(tr.Stop.ActualArrival)
+}
+
+// Risk classifies the transfer: it is missed if the buffer is negative and
+// tight if the buffer is less than minTransfer, the time needed to change
+// platforms.
+func (tr Transfer) Risk(minTransfer time.Duration) TransferRisk {
+	switch b := tr.Buffer(); {
+	case b < 0:
+		return TransferMissed
+	case b < minTransfer:
+		return TransferTight
+	}
+	return TransferOK
+}
+
+// Transfer returns the transfer to t's connection. It returns false if the
+// portal provided no connection or the connection's station is not a stop of
+// the trip.
+func (t *Trip) Transfer() (Transfer, bool) {
+	c := t.Connection
+	if c == nil || c.Station == nil || !ValidTime(c.ActualDeparture) {
+		return Transfer{}, false
+	}
+
+	stop := t.findStop(c.Station.ID)
+	if stop == nil {
+		return Transfer{}, false
+	}
+
+	return Transfer{Stop: stop, Departure: c.ActualDeparture}, true
+}
@@ -0,0 +1,91 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const connectionStr = `{
+   "trainType" : "ICE",
+   "vzn" : "1007",
+   "station" : {
+      "evaNr" : "8000261_00",
+      "name" : "München Hbf"
+   },
+   "track" : {
+      "scheduled" : "14",
+      "actual" : "15"
+   },
+   "timetable" : {
+      "scheduledDepartureTime" : 1533194100000,
+      "actualDepartureTime" : 1533194220000
+   }
+}`
+
+func TestTripConnection(t *testing.T) {
+	input := strings.Replace(inputStr, `"connection" : null`, `"connection" : `+connectionStr, 1)
+
+	var trip Trip
+	if err := json.Unmarshal([]byte(input), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	c := trip.Connection
+	if c == nil {
+		t.Fatal("trip.Connection = nil")
+	}
+	if got, want := c.TrainType+c.TrainID, "ICE1007"; got != want {
+		t.Errorf("connection train = %q, want %q", got, want)
+	}
+	if got, want := c.Platform, "15"; got != want {
+		t.Errorf("c.Platform = %q, want %q", got, want)
+	}
+	if got, want := c.Conflict, "NO_CONFLICT"; got != want {
+		t.Errorf("c.Conflict = %q, want %q", got, want)
+	}
+
+	tr, ok := trip.Transfer()
+	if !ok {
+		t.Fatal("trip.Transfer() failed")
+	}
+	if got, want := tr.Stop, trip.Stops[10]; got != want {
+		t.Errorf("tr.Stop = %v, want %v", got, want)
+	}
+	// Arrival is at 1533193620, the connection departs at 1533194220.
+	if got, want := tr.Buffer(), 10*time.Minute; got != want {
+		t.Errorf("tr.Buffer() = %v, want %v", got, want)
+	}
+
+	var noConnection Trip
+	if err := json.Unmarshal([]byte(inputStr), &noConnection); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	if _, ok := noConnection.Transfer(); ok {
+		t.Error("Transfer() succeeded for trip without connection")
+	}
+}
+
+func TestTransferRisk(t *testing.T) {
+	arrival := time.Unix(1533193620, 0)
+	stop := &Stop{ActualArrival: arrival}
+
+	cases := []struct {
+		departure time.Time
+		want      TransferRisk
+	}{
+		{arrival.Add(20 * time.Minute), TransferOK},
+		{arrival.Add(5 * time.Minute), TransferOK},
+		{arrival.Add(4 * time.Minute), TransferTight},
+		{arrival, TransferTight},
+		{arrival.Add(-time.Minute), TransferMissed},
+	}
+
+	for _, c := range cases {
+		tr := Transfer{Stop: stop, Departure: c.departure}
+		if got := tr.Risk(5 * time.Minute); got != c.want {
+			t.Errorf("Transfer{Buffer: %v}.Risk(5m) = %v, want %v", tr.Buffer(), got, c.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import "time"
+
+// DelayTrendWindow is the period of time over which the trend of a delay is
+// determined.
+const DelayTrendWindow = 10 * time.Minute
+
+// DelayTrend is the direction in which a delay develops.
+type DelayTrend int
+
+// Delay trends.
+const (
+	DelayStable DelayTrend = iota
+	DelayGrowing
+	DelayShrinking
+)
+
+func (t DelayTrend) String() string {
+	switch t {
+	case DelayGrowing:
+		return "growing"
+	case DelayShrinking:
+		return "shrinking"
+	}
+	return "stable"
+}
+
+// Arrow returns an arrow pointing up for a growing delay, down for a
+// shrinking delay and right for a stable delay.
+func (t DelayTrend) Arrow() string {
+	switch t {
+	case DelayGrowing:
+		return "↑"
+	case DelayShrinking:
+		return "↓"
+	}
+	return "→"
+}
+
+// DelaySample is the delay of a stop observed at a point in time.
+type DelaySample struct {
+	Time  time.Time
+	Delay time.Duration
+}
+
+// DelayStats describes how the delay of a stop developed.
+type DelayStats struct {
+	Current time.Duration
+	Max     time.Duration
+	Trend   DelayTrend
+	// Rate is the change of the delay per minute over DelayTrendWindow.
+	Rate time.Duration
+	// History holds the delay whenever it changed, oldest first.
+	History []DelaySample
+}
+
+// DelayTracker records the delays of upcoming stops across updates of the
+// trip. The zero value is ready to use. A DelayTracker is not safe for
+// concurrent use.
+type DelayTracker struct {
+	updated time.Time
+	history map[string][]DelaySample
+	max     map[string]time.Duration
+}
+
+// Update records the delays of the stops of trip, as observed at time t.
+// Stops the train has passed are ignored.
+func (dt *DelayTracker) Update(trip *Trip, t time.Time) {
+	if dt.history == nil {
+		dt.history = make(map[string][]DelaySample)
+		dt.max = make(map[string]time.Duration)
+	}
+	dt.updated = t
+
+	for _, s := range trip.Stops {
+		if s.Passed || !ValidTime(s.ActualArrival) {
+			continue
+		}
+		id, d := s.Station.ID, s.Delay()
+
+		h := dt.history[id]
+		if n := len(h); n == 0 || h[n-1].Delay != d {
+			dt.history[id] = append(h, DelaySample{Time: t, Delay: d})
+		}
+		if max, ok := dt.max[id]; !ok || d > max {
+			dt.max[id] = d
+		}
+	}
+}
+
+// Stats returns how the delay of s developed. It returns false if no delay
+// has been recorded for s.
+func (dt *DelayTracker) Stats(s *Stop) (DelayStats, bool) {
+	h := dt.history[s.Station.ID]
+	if len(h) == 0 {
+		return DelayStats{}, false
+	}
+
+	stats := DelayStats{
+		Current: h[len(h)-1].Delay,
+		Max:     dt.max[s.Station.ID],
+		History: append([]DelaySample(nil), h...),
+	}
+
+	// The delay at the beginning of the window is the last one recorded
+	// before it.
+	start := dt.updated.Add(-DelayTrendWindow)
+	if start.Before(h[0].Time) {
+		start = h[0].Time
+	}
+	before := h[0].Delay
+	for _, sample := range h {
+		if sample.Time.After(start) {
+			break
+		}
+		before = sample.Delay
+	}
+
+	change := stats.Current - before
+	if elapsed := dt.updated.Sub(start); elapsed > 0 {
+		stats.Rate = time.Duration(float64(change) / elapsed.Minutes())
+	}
+
+	// The portal reports delays in full minutes.
+	switch {
+	case change >= time.Minute:
+		stats.Trend = DelayGrowing
+	case change <= -time.Minute:
+		stats.Trend = DelayShrinking
+	}
+
+	return stats, true
+}
@@ -0,0 +1,70 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayTracker(t *testing.T) {
+	scheduled := time.Unix(1533193620, 0)
+	stop := &Stop{
+		Station:          &Station{ID: "8000261_00", Name: "München Hbf"},
+		ScheduledArrival: scheduled,
+	}
+	passed := &Stop{
+		Station: &Station{ID: "8000284_00", Name: "Nürnberg Hbf"},
+		Passed:  true,
+	}
+	trip := &Trip{Stops: []*Stop{passed, stop}}
+
+	var dt DelayTracker
+	if _, ok := dt.Stats(stop); ok {
+		t.Fatal("Stats() succeeded without updates")
+	}
+
+	t0 := scheduled.Add(-time.Hour)
+	delays := []time.Duration{
+		2 * time.Minute,
+		6 * time.Minute,
+		6 * time.Minute,
+		8 * time.Minute,
+		4 * time.Minute,
+	}
+	for i, d := range delays {
+		stop.ActualArrival = scheduled.Add(d)
+		dt.Update(trip, t0.Add(time.Duration(i)*5*time.Minute))
+	}
+
+	got, ok := dt.Stats(stop)
+	if !ok {
+		t.Fatal("Stats() failed")
+	}
+	if got.Current != 4*time.Minute {
+		t.Errorf("Current = %v, want %v", got.Current, 4*time.Minute)
+	}
+	if got.Max != 8*time.Minute {
+		t.Errorf("Max = %v, want %v", got.Max, 8*time.Minute)
+	}
+	// The unchanged delay is recorded only once.
+	if got, want := len(got.History), 4; got != want {
+		t.Errorf("len(History) = %d, want %d", got, want)
+	}
+	// Ten minutes ago, the delay was six minutes.
+	if got.Trend != DelayShrinking {
+		t.Errorf("Trend = %v, want %v", got.Trend, DelayShrinking)
+	}
+	if want := -12 * time.Second; got.Rate != want {
+		t.Errorf("Rate = %v, want %v", got.Rate, want)
+	}
+
+	stop.ActualArrival = scheduled.Add(4*time.Minute + 30*time.Second)
+	dt.Update(trip, t0.Add(25*time.Minute))
+	// 8 → 4.5 minutes in the last ten minutes.
+	if got, _ := dt.Stats(stop); got.Trend != DelayShrinking {
+		t.Errorf("Trend = %v, want %v", got.Trend, DelayShrinking)
+	}
+
+	if _, ok := dt.Stats(passed); ok {
+		t.Error("Stats() succeeded for passed stop")
+	}
+}
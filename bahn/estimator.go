@@ -0,0 +1,87 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"math"
+	"time"
+)
+
+// Estimator estimates the train's position between polls by dead reckoning:
+// starting from the last known position, the train is assumed to move towards
+// the next stop at the last known speed. An Estimator is not safe for
+// concurrent use.
+type Estimator struct {
+	trip       *Trip
+	tripTime   time.Time
+	status     *Status
+	statusTime time.Time
+}
+
+// UpdateTrip sets the trip information, received at time t.
+func (e *Estimator) UpdateTrip(trip *Trip, t time.Time) {
+	e.trip, e.tripTime = trip, t
+}
+
+// UpdateStatus sets the status information, received at time t.
+func (e *Estimator) UpdateStatus(s *Status, t time.Time) {
+	e.status, e.statusTime = s, t
+}
+
+func (e *Estimator) speed() float64 {
+	if e.status == nil {
+		return 0
+	}
+	return e.status.Speed
+}
+
+// Trip returns the trip with the train's position extrapolated to time t, or
+// nil if no trip information has been received.
+func (e *Estimator) Trip(t time.Time) *Trip {
+	if e.trip == nil {
+		return nil
+	}
+	return e.trip.Extrapolate(e.speed(), t.Sub(e.tripTime))
+}
+
+// Position estimates the train's position at time t. It returns false if
+// neither a position fix nor trip information is available.
+func (e *Estimator) Position(t time.Time) (Position, bool) {
+	var next *Stop
+	if e.trip != nil {
+		next = e.trip.NextStop
+	}
+
+	if e.status != nil && !e.status.Position().IsZero() {
+		fix := e.status.Position()
+		if next == nil || t.Before(e.statusTime) {
+			return fix, true
+		}
+
+		// Move from the last fix towards the next stop by the distance
+		// covered since the fix.
+		remaining := e.trip.Extrapolate(e.speed(), e.statusTime.Sub(e.tripTime)).DistanceTo(next)
+		covered := e.speed() * t.Sub(e.statusTime).Hours()
+		if remaining <= covered {
+			return next.Station.Position(), true
+		}
+		return fix.interpolate(next.Station.Position(), covered/remaining), true
+	}
+
+	if e.trip == nil || next == nil {
+		return Position{}, false
+	}
+
+	// Without a position fix, interpolate between the previous and the next stop.
+	prev := e.trip.PreviousStop
+	if prev == nil {
+		return next.Station.Position(), true
+	}
+
+	segment := next.DistanceFromStart - prev.DistanceFromStart
+	if segment <= 0 {
+		return next.Station.Position(), true
+	}
+	f := (e.Trip(t).DistanceFromStart() - prev.DistanceFromStart) / segment
+	f = math.Max(0, math.Min(1, f))
+
+	return prev.Station.Position().interpolate(next.Station.Position(), f), true
+}
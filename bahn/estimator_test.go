@@ -0,0 +1,73 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestEstimator(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	munich := trip.Stops[10]
+	approxFloat := cmpopts.EquateApprox(0, .001)
+
+	t0 := time.Unix(1533191000, 0)
+	var e Estimator
+
+	if _, ok := e.Position(t0); ok {
+		t.Errorf("Position() of empty estimator succeeded")
+	}
+
+	e.UpdateTrip(&trip, t0)
+
+	// Without a position fix, the position is interpolated between Nürnberg
+	// and München: 136.9 of 149.3 km.
+	got, ok := e.Position(t0)
+	if !ok {
+		t.Fatalf("Position() failed")
+	}
+	f := 136.911 / 149.312
+	want := Position{
+		Latitude:  49.445616 + f*(48.140232-49.445616),
+		Longitude: 11.082989 + f*(11.558335-11.082989),
+	}
+	if !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Position() = %v, want %v", got, want)
+	}
+
+	// With a position fix, the train moves from the fix towards the next stop.
+	fix := Position{Latitude: 48.2, Longitude: 11.5}
+	e.UpdateStatus(&Status{Speed: 124.01, Latitude: fix.Latitude, Longitude: fix.Longitude}, t0)
+
+	if got := mustPosition(t, &e, t0); !cmp.Equal(got, fix, approxFloat) {
+		t.Errorf("Position(t0) = %v, want %v", got, fix)
+	}
+
+	// 3 minutes at 124.01 km/h are half of the remaining 12.401 km.
+	want = fix.interpolate(munich.Station.Position(), 0.5)
+	if got := mustPosition(t, &e, t0.Add(3*time.Minute)); !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Position(t0+3m) = %v, want %v", got, want)
+	}
+	if got, want := e.Trip(t0.Add(3*time.Minute)).DistanceTo(munich), 12.401/2; !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Trip(t0+3m).DistanceTo(%v) = %g, want %g", munich, got, want)
+	}
+
+	// The train does not overshoot the next stop.
+	if got, want := mustPosition(t, &e, t0.Add(time.Hour)), munich.Station.Position(); !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Position(t0+1h) = %v, want %v", got, want)
+	}
+}
+
+func mustPosition(t *testing.T, e *Estimator, at time.Time) Position {
+	p, ok := e.Position(at)
+	if !ok {
+		t.Fatalf("Position(%v) failed", at)
+	}
+	return p
+}
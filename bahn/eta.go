@@ -0,0 +1,185 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// speedWindow is the period of time recent speed samples are kept for.
+const speedWindow = 10 * time.Minute
+
+// minSpeed is the speed, in km/h, below which a speed sample is not used to
+// predict the travel time, e.g. when the train is waiting at a signal.
+const minSpeed = 5.0
+
+// Prediction is an estimated time of arrival. ETA is the most likely travel
+// time, Early and Late bound the range of plausible travel times.
+type Prediction struct {
+	ETA   time.Duration
+	Early time.Duration
+	Late  time.Duration
+}
+
+type speedSample struct {
+	time  time.Time
+	speed float64
+}
+
+// ETAPredictor predicts the arrival time at stops independently of the
+// portal's estimate. It combines the distance to the stop, the current and
+// recent speed of the train and the timings of the segments traveled so far.
+// An ETAPredictor is not safe for concurrent use.
+type ETAPredictor struct {
+	samples []speedSample
+}
+
+// AddSpeed records the speed, in km/h, measured at time t.
+func (p *ETAPredictor) AddSpeed(t time.Time, kmh float64) {
+	p.samples = append(p.samples, speedSample{time: t, speed: kmh})
+
+	i := 0
+	for i < len(p.samples) && t.Sub(p.samples[i].time) > speedWindow {
+		i++
+	}
+	p.samples = p.samples[i:]
+}
+
+// speeds returns the candidate speeds for the current segment: the current
+// speed, the average of recent speeds and the speed required to keep the
+// schedule.
+func (p *ETAPredictor) speeds(scheduled float64) []float64 {
+	var candidates []float64
+	if scheduled >= minSpeed {
+		candidates = append(candidates, scheduled)
+	}
+
+	if n := len(p.samples); n != 0 {
+		if cur := p.samples[n-1].speed; cur >= minSpeed {
+			candidates = append(candidates, cur)
+		}
+
+		var sum float64
+		for _, s := range p.samples {
+			sum += s.speed
+		}
+		if avg := sum / float64(n); avg >= minSpeed {
+			candidates = append(candidates, avg)
+		}
+	}
+
+	sort.Float64s(candidates)
+	return candidates
+}
+
+// scheduledDuration returns the scheduled travel time between departing from
+// "from" and arriving at "to".
+func scheduledDuration(from, to *Stop) time.Duration {
+	return to.ScheduledArrival.Sub(from.ScheduledDeparture)
+}
+
+// actualDuration returns the actual travel time between departing from
+// "from" and arriving at "to".
+func actualDuration(from, to *Stop) time.Duration {
+	return to.ActualArrival.Sub(from.ActualDeparture)
+}
+
+// timeRatios returns, for each segment the train has completed, the ratio of
+// actual to scheduled travel time.
+func timeRatios(trip *Trip) []float64 {
+	var ratios []float64
+	for i := 1; i < len(trip.Stops); i++ {
+		from, to := trip.Stops[i-1], trip.Stops[i]
+		if !to.Passed {
+			break
+		}
+
+		sched, act := scheduledDuration(from, to), actualDuration(from, to)
+		if sched <= 0 || act <= 0 {
+			continue
+		}
+		ratios = append(ratios, float64(act)/float64(sched))
+	}
+
+	return ratios
+}
+
+// Predict estimates the travel time from the train's current position to
+// stop. It returns false if stop has been passed or not enough information
+// is available.
+func (p *ETAPredictor) Predict(trip *Trip, stop *Stop) (Prediction, bool) {
+	next := trip.NextStop
+	if stop.Passed || next == nil {
+		return Prediction{}, false
+	}
+
+	nextIdx, stopIdx := -1, -1
+	for i, s := range trip.Stops {
+		if s == next {
+			nextIdx = i
+		}
+		if s == stop {
+			stopIdx = i
+		}
+	}
+	if nextIdx < 1 || stopIdx < nextIdx {
+		return Prediction{}, false
+	}
+
+	// The segment the train is currently on.
+	prev := trip.Stops[nextIdx-1]
+	var scheduledSpeed float64
+	if d := scheduledDuration(prev, next); d > 0 {
+		scheduledSpeed = next.DistanceFromLastStop / d.Hours()
+	}
+	speeds := p.speeds(scheduledSpeed)
+	if len(speeds) == 0 {
+		return Prediction{}, false
+	}
+
+	distance := math.Max(trip.DistanceTo(next), 0)
+	hours := func(kmh float64) time.Duration {
+		return time.Duration(distance / kmh * float64(time.Hour))
+	}
+	pred := Prediction{
+		ETA:   hours(median(speeds)),
+		Early: hours(speeds[len(speeds)-1]),
+		Late:  hours(speeds[0]),
+	}
+
+	// Subsequent segments: the scheduled travel time, scaled by how well the
+	// train kept the schedule on the segments traveled so far.
+	ratio, early, late := 1.0, 1.0, 1.0
+	if ratios := timeRatios(trip); len(ratios) != 0 {
+		sort.Float64s(ratios)
+		ratio, early, late = median(ratios), ratios[0], ratios[len(ratios)-1]
+	}
+
+	for i := nextIdx + 1; i <= stopIdx; i++ {
+		from, to := trip.Stops[i-1], trip.Stops[i]
+
+		dwell := from.ScheduledDeparture.Sub(from.ScheduledArrival)
+		if dwell < 0 {
+			dwell = 0
+		}
+		travel := float64(scheduledDuration(from, to))
+		if travel < 0 {
+			travel = 0
+		}
+
+		pred.ETA += dwell + time.Duration(travel*ratio)
+		pred.Early += dwell + time.Duration(travel*math.Min(early, 1))
+		pred.Late += dwell + time.Duration(travel*math.Max(late, 1))
+	}
+
+	return pred, true
+}
+
+// median returns the median of the sorted slice data.
+func median(data []float64) float64 {
+	n := len(data)
+	if n%2 == 1 {
+		return data[n/2]
+	}
+	return (data[n/2-1] + data[n/2]) / 2
+}
@@ -0,0 +1,87 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestETAPredictor(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	munich := trip.Stops[10]
+
+	var p ETAPredictor
+	t0 := time.Unix(1533191000, 0)
+	p.AddSpeed(t0.Add(-20*time.Minute), 300) // outside of the window
+	p.AddSpeed(t0, 124.01)
+
+	// 12.401 km at 124.01 km/h take 6 minutes. The schedule requires
+	// 149.312 km in 65 minutes, i.e. 137.8 km/h.
+	got, ok := p.Predict(&trip, munich)
+	if !ok {
+		t.Fatal("Predict() failed")
+	}
+	want := Prediction{
+		ETA:   6 * time.Minute,
+		Early: minutes(12.401 / (149.312 / 65.0)),
+		Late:  6 * time.Minute,
+	}
+	if !durationsEqual(got, want) {
+		t.Errorf("Predict(%v) = %+v, want %+v", munich, got, want)
+	}
+
+	if _, ok := p.Predict(&trip, trip.Stops[9]); ok {
+		t.Errorf("Predict(%v) succeeded for passed stop", trip.Stops[9])
+	}
+}
+
+func TestETAPredictorSubsequentSegments(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	// Move the train back to 10 km before Nürnberg.
+	nuremberg, munich := trip.Stops[9], trip.Stops[10]
+	nuremberg.Passed = false
+	trip.NextStop = nuremberg
+	trip.PreviousStop = trip.Stops[8]
+	trip.DistanceFromLastStop = nuremberg.DistanceFromLastStop - 10
+
+	var p ETAPredictor
+	p.AddSpeed(time.Unix(1533191000, 0), 120)
+
+	got, ok := p.Predict(&trip, munich)
+	if !ok {
+		t.Fatal("Predict() failed")
+	}
+
+	// 5 minutes to Nürnberg at 120 km/h, or 5.9 minutes at the scheduled
+	// 101.9 km/h (91.662 km in 54 minutes), 3 minutes dwell time and 65 minutes scheduled
+	// travel time, scaled by the ratio of actual to scheduled travel time of
+	// the previous segments. Their median is 0.975, the extremes are 0.9
+	// (Montabaur to Limburg Süd) and 1.2 (Frankfurt Flughafen to Frankfurt Hbf).
+	want := Prediction{
+		ETA:   minutes(5 + 3 + 65*0.975),
+		Early: minutes(5 + 3 + 65*0.9),
+		Late:  minutes(10/(91.662/54.0) + 3 + 65*1.2),
+	}
+	if !durationsEqual(got, want) {
+		t.Errorf("Predict(%v) = %+v, want %+v", munich, got, want)
+	}
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+func durationsEqual(a, b Prediction) bool {
+	eq := func(x, y time.Duration) bool {
+		d := x - y
+		return d > -time.Second && d < time.Second
+	}
+	return eq(a.ETA, b.ETA) && eq(a.Early, b.Early) && eq(a.Late, b.Late)
+}
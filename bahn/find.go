@@ -0,0 +1,235 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestions is the maximum number of suggestions in a StopNotFoundError.
+const maxSuggestions = 3
+
+// AmbiguousStopError is returned by LookupStop if a query matches several stops
+// equally well.
+type AmbiguousStopError struct {
+	Query      string
+	Candidates []*Stop
+}
+
+func (e *AmbiguousStopError) Error() string {
+	return fmt.Sprintf("stop %q is ambiguous, candidates are: %s", e.Query, stationNames(e.Candidates))
+}
+
+// StopNotFoundError is returned by LookupStop if no stop matches a query.
+// Suggestions holds the stops with the most similar names, best first.
+type StopNotFoundError struct {
+	Query       string
+	Suggestions []*Stop
+}
+
+func (e *StopNotFoundError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("stop %q not found", e.Query)
+	}
+	return fmt.Sprintf("stop %q not found, did you mean: %s?", e.Query, stationNames(e.Suggestions))
+}
+
+func stationNames(stops []*Stop) string {
+	var names []string
+	for _, s := range stops {
+		names = append(names, fmt.Sprintf("%q", s.Station.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// Quality of a match between query and station name, best last.
+const (
+	noMatch = iota
+	substringMatch
+	wordPrefixMatch
+	exactMatch
+)
+
+// LookupStop returns the stop in t matching query. The query is either the
+// EVA number of the station, with or without the "_00" suffix the portal
+// uses, or (part of) the station's name. You can specify a city name, e.g.
+// "Basel", and don't have to specify the exact station name, e.g.
+// "Basel Bad Bf".
+//
+// Names are compared case-insensitively and ignoring diacritics, so that
+// "München", "Muenchen" and "munchen" are equivalent. An exact match is
+// preferred over a match at the beginning of a word, which is preferred over
+// a match anywhere in the name. If several stops match equally well, an
+// *AmbiguousStopError is returned. If no stop matches, a *StopNotFoundError
+// is returned.
+func (t *Trip) LookupStop(query string) (*Stop, error) {
+	for _, s := range t.Stops {
+		if s.Station.ID == query || s.Station.EvaNr() == query {
+			return s, nil
+		}
+	}
+
+	q := normalizeName(query)
+	best := noMatch
+	var candidates []*Stop
+	for _, s := range t.Stops {
+		m := matchName(q, normalizeName(s.Station.Name))
+		if m == noMatch || m < best {
+			continue
+		}
+		if m > best {
+			best, candidates = m, nil
+		}
+		candidates = append(candidates, s)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, &StopNotFoundError{
+			Query:       query,
+			Suggestions: t.suggestStops(q),
+		}
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, &AmbiguousStopError{
+			Query:      query,
+			Candidates: candidates,
+		}
+	}
+}
+
+// matchName returns the quality of the match between the normalized query q
+// and the normalized name.
+func matchName(q, name string) int {
+	switch {
+	case q == "":
+		return noMatch
+	case q == name:
+		return exactMatch
+	case strings.HasPrefix(name, q) || strings.Contains(name, " "+q):
+		return wordPrefixMatch
+	case strings.Contains(name, q):
+		return substringMatch
+	}
+	return noMatch
+}
+
+// suggestStops returns the stops whose names are most similar to the
+// normalized query q, ranked by edit distance.
+func (t *Trip) suggestStops(q string) []*Stop {
+	type ranked struct {
+		stop     *Stop
+		distance int
+	}
+
+	// Allow roughly one typo per four characters.
+	maxDistance := len([]rune(q)) / 4
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	var rs []ranked
+	for _, s := range t.Stops {
+		if d := nameDistance(q, normalizeName(s.Station.Name)); d <= maxDistance {
+			rs = append(rs, ranked{stop: s, distance: d})
+		}
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].distance < rs[j].distance
+	})
+
+	var stops []*Stop
+	for i := 0; i < len(rs) && i < maxSuggestions; i++ {
+		stops = append(stops, rs[i].stop)
+	}
+	return stops
+}
+
+// nameDistance returns the edit distance between q and the closest part of
+// name: the whole name or a prefix of a word of name having the length of q.
+func nameDistance(q, name string) int {
+	min := levenshtein(q, name)
+
+	words := strings.Fields(name)
+	for i := range words {
+		rest := []rune(strings.Join(words[i:], " "))
+		if len(rest) > len([]rune(q)) {
+			rest = rest[:len([]rune(q))]
+		}
+		if d := levenshtein(q, string(rest)); d < min {
+			min = d
+		}
+	}
+
+	return min
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// foldings maps letters with diacritics to their base letters.
+var foldings = map[rune]string{
+	'ä': "a", 'à': "a", 'á': "a", 'â': "a", 'å': "a",
+	'ö': "o", 'ò': "o", 'ó': "o", 'ô': "o", 'ø': "o",
+	'ü': "u", 'ù': "u", 'ú': "u", 'û': "u",
+	'é': "e", 'è': "e", 'ê': "e", 'ë': "e",
+	'í': "i", 'ì': "i", 'î': "i", 'ï': "i",
+	'ç': "c", 'ñ': "n", 'ß': "ss",
+}
+
+// digraphs are the transcriptions of German umlauts, e.g. "ue" for "ü".
+var digraphs = strings.NewReplacer("ae", "a", "oe", "o", "ue", "u")
+
+// normalizeName returns a canonical form of name for comparison: lower case,
+// without diacritics, umlaut transcriptions folded ("Muenchen" and "München"
+// both become "munchen") and with punctuation replaced by single spaces.
+func normalizeName(name string) string {
+	var b bytes.Buffer
+	for _, r := range strings.ToLower(name) {
+		if f, ok := foldings[r]; ok {
+			b.WriteString(f)
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	return digraphs.Replace(strings.Join(strings.Fields(b.String()), " "))
+}
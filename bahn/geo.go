@@ -0,0 +1,133 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import "math"
+
+// EarthRadius is the mean radius of the earth, in kilometers.
+const EarthRadius = 6371.0088
+
+// Position is a point on the earth's surface, in degrees.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// IsZero returns true if p is the zero value, which the portal uses for
+// "unknown".
+func (p Position) IsZero() bool {
+	return p.Latitude == 0 && p.Longitude == 0
+}
+
+// interpolate returns the point at fraction f on the straight line from p to q.
+func (p Position) interpolate(q Position, f float64) Position {
+	return Position{
+		Latitude:  p.Latitude + f*(q.Latitude-p.Latitude),
+		Longitude: p.Longitude + f*(q.Longitude-p.Longitude),
+	}
+}
+
+// Position returns the station's position.
+func (s Station) Position() Position {
+	return Position{Latitude: s.Latitude, Longitude: s.Longitude}
+}
+
+// Position returns the train's position.
+func (s Status) Position() Position {
+	return Position{Latitude: s.Latitude, Longitude: s.Longitude}
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// DistanceTo returns the great-circle distance between p and q, in kilometers.
+func (p Position) DistanceTo(q Position) float64 {
+	lat1, lat2 := radians(p.Latitude), radians(q.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(q.Longitude - p.Longitude)
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// BearingTo returns the initial bearing from p to q, in degrees clockwise from
+// north in the range [0, 360).
+func (p Position) BearingTo(q Position) float64 {
+	lat1, lat2 := radians(p.Latitude), radians(q.Latitude)
+	dLon := radians(q.Longitude - p.Longitude)
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// DistanceTo returns the great-circle distance between the train's position
+// and the station, in kilometers.
+func (s Status) DistanceTo(st *Station) float64 {
+	return s.Position().DistanceTo(st.Position())
+}
+
+// BearingTo returns the initial bearing from the train's position to the
+// station, in degrees.
+func (s Status) BearingTo(st *Station) float64 {
+	return s.Position().BearingTo(st.Position())
+}
+
+// NearestStop returns the stop closest to p and the great-circle distance to
+// it, in kilometers. It returns nil if t has no stops.
+func (t *Trip) NearestStop(p Position) (*Stop, float64) {
+	var (
+		nearest *Stop
+		minDist = math.Inf(1)
+	)
+
+	for _, s := range t.Stops {
+		if d := p.DistanceTo(s.Station.Position()); d < minDist {
+			nearest, minDist = s, d
+		}
+	}
+
+	return nearest, minDist
+}
+
+// DistanceCheck compares the portal's distance from the start of the trip
+// with a distance derived from a GPS position.
+type DistanceCheck struct {
+	// Portal is the distance from start reported by the portal, in kilometers.
+	Portal float64
+	// GPS is the distance from start derived from the GPS position, in kilometers.
+	GPS float64
+}
+
+// Deviation returns how far, in kilometers, the GPS derived distance is ahead
+// of the portal's distance. Negative values mean the portal is ahead.
+func (c DistanceCheck) Deviation() float64 {
+	return c.GPS - c.Portal
+}
+
+// CheckDistance derives the distance from the start of the trip from the GPS
+// position p and compares it with the portal's DistanceFromStart. The GPS
+// derived distance is the distance of the previous stop plus the great-circle
+// distance from the previous stop to p, scaled by the ratio of track length to
+// great-circle distance of the current segment. It returns false if the
+// train is not between two stops.
+func (t *Trip) CheckDistance(p Position) (DistanceCheck, bool) {
+	prev, next := t.PreviousStop, t.NextStop
+	if prev == nil || next == nil || p.IsZero() {
+		return DistanceCheck{}, false
+	}
+
+	detour := 1.0
+	if gc := prev.Station.Position().DistanceTo(next.Station.Position()); gc > 0 {
+		detour = (next.DistanceFromStart - prev.DistanceFromStart) / gc
+	}
+
+	return DistanceCheck{
+		Portal: t.DistanceFromStart(),
+		GPS:    prev.DistanceFromStart + detour*prev.Station.Position().DistanceTo(p),
+	}, true
+}
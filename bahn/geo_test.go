@@ -0,0 +1,104 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestPositionDistanceAndBearing(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	cologne := trip.Stops[0].Station
+	frankfurt := trip.Stops[5].Station
+	nuremberg := trip.Stops[9].Station
+	munich := trip.Stops[10].Station
+
+	cases := []struct {
+		from, to        *Station
+		distance, angle float64
+	}{
+		{cologne, munich, 455.113, 131.431},
+		{cologne, frankfurt, 152.201, 126.976},
+		{nuremberg, munich, 149.270, 166.331},
+		{munich, cologne, 455.113, 314.933},
+		{munich, munich, 0, 0},
+	}
+
+	approx := cmpopts.EquateApprox(0, .001)
+	for _, c := range cases {
+		from, to := c.from.Position(), c.to.Position()
+		if got := from.DistanceTo(to); !cmp.Equal(got, c.distance, approx) {
+			t.Errorf("%v.DistanceTo(%v) = %g, want %g", c.from, c.to, got, c.distance)
+		}
+		if got := from.BearingTo(to); !cmp.Equal(got, c.angle, approx) {
+			t.Errorf("%v.BearingTo(%v) = %g, want %g", c.from, c.to, got, c.angle)
+		}
+	}
+
+	s := Status{Latitude: munich.Latitude, Longitude: munich.Longitude}
+	if got, want := s.DistanceTo(cologne), 455.113; !cmp.Equal(got, want, approx) {
+		t.Errorf("Status.DistanceTo(%v) = %g, want %g", cologne, got, want)
+	}
+}
+
+func TestTripNearestStop(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	// Between Frankfurt Flughafen and Frankfurt Hbf, closer to the latter.
+	p := Position{Latitude: 50.1, Longitude: 8.65}
+	got, dist := trip.NearestStop(p)
+	if want := trip.Stops[5]; got != want {
+		t.Errorf("NearestStop(%v) = %v, want %v", p, got, want)
+	}
+	if want := p.DistanceTo(trip.Stops[5].Station.Position()); dist != want {
+		t.Errorf("NearestStop(%v) distance = %g, want %g", p, dist, want)
+	}
+
+	var empty Trip
+	if got, _ := empty.NearestStop(p); got != nil {
+		t.Errorf("NearestStop() of empty trip = %v, want nil", got)
+	}
+}
+
+func TestTripCheckDistance(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	nuremberg, munich := trip.Stops[9].Station.Position(), trip.Stops[10].Station.Position()
+
+	// A position on the straight line between Nürnberg and München, at the
+	// fraction of the segment the portal reports as traveled.
+	f := 136.911 / 149.312
+	p := Position{
+		Latitude:  nuremberg.Latitude + f*(munich.Latitude-nuremberg.Latitude),
+		Longitude: nuremberg.Longitude + f*(munich.Longitude-nuremberg.Longitude),
+	}
+
+	got, ok := trip.CheckDistance(p)
+	if !ok {
+		t.Fatalf("CheckDistance(%v) failed", p)
+	}
+	if want := 354.328 + 136.911; !cmp.Equal(got.Portal, want, cmpopts.EquateApprox(0, .001)) {
+		t.Errorf("CheckDistance(%v).Portal = %g, want %g", p, got.Portal, want)
+	}
+	// Interpolating linearly in degrees is not exactly a great circle, so
+	// allow for 100 m deviation.
+	if dev := got.Deviation(); dev < -0.1 || dev > 0.1 {
+		t.Errorf("CheckDistance(%v).Deviation() = %g, want approx. 0", p, dev)
+	}
+
+	if _, ok := trip.CheckDistance(Position{}); ok {
+		t.Error("CheckDistance() succeeded without a position")
+	}
+}
@@ -0,0 +1,108 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy determines how often and when failed requests are retried.
+// Only transient errors, as determined by IsTransient, are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values less than two disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the time to wait between attempts. Zero means no limit.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor the backoff grows by after each attempt.
+	// Values less than one are treated as two.
+	Multiplier float64
+
+	// Jitter is the fraction, between zero and one, by which the backoff is
+	// randomly reduced to avoid synchronized retries of many clients.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is a retry policy suitable for the flaky connectivity
+// on trains.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns the time to wait before retry number n, starting at zero.
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(n))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		d -= d * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// IsTransient returns true if err is likely caused by a temporary condition,
+// such as a network outage or an overloaded server, so that retrying the
+// request may succeed.
+func IsTransient(err error) bool {
+	switch err := err.(type) {
+	case *HTTPError:
+		return err.StatusCode >= 500 ||
+			err.StatusCode == http.StatusTooManyRequests ||
+			err.StatusCode == http.StatusRequestTimeout
+	case *url.Error:
+		// *url.Error implements net.Error, too, but also wraps permanent
+		// errors, e.g. an unsupported protocol scheme or an invalid
+		// certificate.
+		return IsTransient(err.Err)
+	case *net.OpError:
+		// Includes refused connections and failed DNS lookups, which are
+		// common while the train's network is unavailable.
+		return true
+	case net.Error:
+		return err.Timeout() || err.Temporary()
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Do calls f until it succeeds, returns a permanent error, the maximum
+// number of attempts is reached or ctx is cancelled. It returns the error of
+// the last attempt. A nil policy calls f once.
+func (p *RetryPolicy) Do(ctx context.Context, f func() error) error {
+	for n := 0; ; n++ {
+		err := f()
+		if err == nil || p == nil || n+1 >= p.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		t := time.NewTimer(p.Backoff(n))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+
+	for n, want := range []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		if got := p.Backoff(n); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("Backoff(2) = %v, want value in [2s, 4s]", got)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{io.ErrUnexpectedEOF, true},
+		{&url.Error{Op: "Get", URL: "http://iceportal.de/api1/rs/status", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, true},
+		{&url.Error{Op: "Get", URL: "http://iceportal.de/api1/rs/status", Err: io.EOF}, true},
+		{&url.Error{Op: "Get", URL: "ftp://example.invalid/api1/rs/status", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+		{errors.New("invalid character '<' looking for beginning of value"), false},
+	}
+
+	for _, c := range cases {
+		if got := IsTransient(c.err); got != c.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+
+	// http.Client returns a *url.Error for unsupported schemes, too.
+	c := &Client{BaseURL: "ftp://example.invalid"}
+	if _, err := c.Status(context.Background()); err == nil || IsTransient(err) {
+		t.Errorf("IsTransient(%v) = true, want false", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case StatusPath:
+			if requests < 3 {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, statusStr)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		BaseURL: srv.URL,
+		Retry: &RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Millisecond,
+		},
+	}
+
+	if _, err := c.Status(context.Background()); err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if got, want := requests, 3; got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+
+	// Permanent errors are not retried.
+	requests = 0
+	if _, err := c.Trip(context.Background()); err == nil {
+		t.Fatal("Trip() succeeded, want error")
+	}
+	if got, want := requests, 1; got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import "math"
+
+// Route is the geometry of a train's route, a polyline of positions along
+// the track. It is used to compute along-track distances from GPS positions,
+// which is more accurate than the portal's distance information.
+type Route struct {
+	points []Position
+	// cumulative holds the distance from the first point to each point, in kilometers.
+	cumulative []float64
+}
+
+// NewRoute returns a route along points. Consecutive duplicate points are
+// ignored.
+func NewRoute(points []Position) *Route {
+	r := &Route{}
+
+	for _, p := range points {
+		if n := len(r.points); n != 0 {
+			last := r.points[n-1]
+			if last == p {
+				continue
+			}
+			r.cumulative = append(r.cumulative, r.cumulative[n-1]+last.DistanceTo(p))
+		} else {
+			r.cumulative = append(r.cumulative, 0)
+		}
+		r.points = append(r.points, p)
+	}
+
+	return r
+}
+
+// Length returns the length of the route, in kilometers.
+func (r *Route) Length() float64 {
+	if len(r.cumulative) == 0 {
+		return 0
+	}
+	return r.cumulative[len(r.cumulative)-1]
+}
+
+// Snap projects p onto the closest point of the route. It returns the
+// distance along the route from its start to the projected point and the
+// distance between p and the projected point, both in kilometers.
+func (r *Route) Snap(p Position) (along, offset float64) {
+	switch len(r.points) {
+	case 0:
+		return 0, math.Inf(1)
+	case 1:
+		return 0, p.DistanceTo(r.points[0])
+	}
+
+	offset = math.Inf(1)
+	for i := 1; i < len(r.points); i++ {
+		a, b := r.points[i-1], r.points[i]
+		f := projectOnSegment(p, a, b)
+		q := a.interpolate(b, f)
+
+		if d := p.DistanceTo(q); d < offset {
+			offset = d
+			along = r.cumulative[i-1] + f*(r.cumulative[i]-r.cumulative[i-1])
+		}
+	}
+
+	return along, offset
+}
+
+// DistanceBetween returns the along-track distance from p to q, in
+// kilometers. The result is negative if q lies before p on the route.
+func (r *Route) DistanceBetween(p, q Position) float64 {
+	a, _ := r.Snap(p)
+	b, _ := r.Snap(q)
+	return b - a
+}
+
+// projectOnSegment returns the fraction, between zero and one, of the segment
+// from a to b where the point closest to p lies. It uses an equirectangular
+// projection, which is sufficiently precise for the short segments of a route.
+func projectOnSegment(p, a, b Position) float64 {
+	k := math.Cos(radians((a.Latitude + b.Latitude) / 2))
+
+	dx, dy := (b.Longitude-a.Longitude)*k, b.Latitude-a.Latitude
+	px, py := (p.Longitude-a.Longitude)*k, p.Latitude-a.Latitude
+
+	l2 := dx*dx + dy*dy
+	if l2 == 0 {
+		return 0
+	}
+
+	return math.Max(0, math.Min(1, (px*dx+py*dy)/l2))
+}
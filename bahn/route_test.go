@@ -0,0 +1,64 @@
+package bahn // import "github.com/octo/icestat/bahn"
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestRoute(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	// A crude route connecting the stations with straight lines.
+	var points []Position
+	for _, s := range trip.Stops {
+		points = append(points, s.Station.Position())
+		points = append(points, s.Station.Position()) // duplicates are ignored
+	}
+	r := NewRoute(points)
+
+	approx := cmpopts.EquateApprox(0, .001)
+	var want float64
+	for i, s := range trip.Stops {
+		if i > 0 {
+			want += trip.Stops[i-1].Station.Position().DistanceTo(s.Station.Position())
+		}
+
+		along, offset := r.Snap(s.Station.Position())
+		if !cmp.Equal(along, want, approx) {
+			t.Errorf("Snap(%v) along = %g, want %g", s.Station, along, want)
+		}
+		if !cmp.Equal(offset, 0.0, approx) {
+			t.Errorf("Snap(%v) offset = %g, want 0", s.Station, offset)
+		}
+	}
+	if got := r.Length(); !cmp.Equal(got, want, approx) {
+		t.Errorf("Length() = %g, want %g", got, want)
+	}
+
+	// A point 1 km east of the midpoint between Nürnberg and München.
+	nuremberg, munich := trip.Stops[9].Station.Position(), trip.Stops[10].Station.Position()
+	mid := nuremberg.interpolate(munich, 0.5)
+	east := Position{Latitude: mid.Latitude, Longitude: mid.Longitude + 1/(111.195*0.6585)}
+
+	along, offset := r.Snap(east)
+	segment := nuremberg.DistanceTo(munich)
+	if got, want := along, r.Length()-segment/2; got < want-1 || got > want+1 {
+		t.Errorf("Snap(%v) along = %g, want %g±1", east, got, want)
+	}
+	if offset < 0.5 || offset > 1 {
+		t.Errorf("Snap(%v) offset = %g, want value in [0.5, 1]", east, offset)
+	}
+
+	if got, want := r.DistanceBetween(nuremberg, munich), segment; !cmp.Equal(got, want, approx) {
+		t.Errorf("DistanceBetween(Nürnberg, München) = %g, want %g", got, want)
+	}
+	if got, want := r.DistanceBetween(munich, nuremberg), -segment; !cmp.Equal(got, want, approx) {
+		t.Errorf("DistanceBetween(München, Nürnberg) = %g, want %g", got, want)
+	}
+}
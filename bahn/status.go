@@ -3,12 +3,11 @@ package bahn // import "github.com/octo/icestat/bahn"
 import (
 	"context"
 	"encoding/json"
-	"net/http"
 	"time"
 )
 
 // StatusURL is the URL of JSON encoded information about the train's location and speed.
-const StatusURL = "https://iceportal.de/api1/rs/status"
+const StatusURL = DefaultBaseURL + StatusPath
 
 // Status holds the information returned by the status API call.
 type Status struct {
@@ -46,23 +45,7 @@ func (s *Status) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-// StatusInfo calls the status API and returns the parsed data.
+// StatusInfo calls the status API using DefaultClient and returns the parsed data.
 func StatusInfo(ctx context.Context) (*Status, error) {
-	req, err := http.NewRequest(http.MethodGet, StatusURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req = req.WithContext(ctx)
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	var s Status
-	if err := json.NewDecoder(res.Body).Decode(&s); err != nil {
-		return nil, err
-	}
-
-	return &s, nil
+	return DefaultClient.Status(ctx)
 }
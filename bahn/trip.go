@@ -4,13 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"strings"
 	"time"
 )
 
 // TripInfoURL is the URL of JSON encoded information about the train's schedule.
-const TripInfoURL = "https://iceportal.de/api1/rs/tripInfo/trip"
+const TripInfoURL = DefaultBaseURL + TripInfoPath
 
 // Station is a train station.
 type Station struct {
@@ -48,9 +47,38 @@ func (s Station) String() string {
 	return s.Name
 }
 
+// EvaNr returns the EVA number of the station, i.e. ID without the "_00"
+// suffix the portal appends.
+func (s Station) EvaNr() string {
+	return strings.SplitN(s.ID, "_", 2)[0]
+}
+
+// StopStatus indicates whether a stop is served as scheduled.
+type StopStatus int
+
+// Stop statuses, as reported by the portal.
+const (
+	StopNormal     StopStatus = 0
+	StopAdditional StopStatus = 1
+	StopCancelled  StopStatus = 2
+)
+
+func (s StopStatus) String() string {
+	switch s {
+	case StopNormal:
+		return "normal"
+	case StopAdditional:
+		return "additional"
+	case StopCancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("StopStatus(%d)", int(s))
+}
+
 // Stop is a scheduled stop along the route.
 type Stop struct {
 	Station              *Station
+	Status               StopStatus
 	Platform             string
 	DistanceFromStart    float64
 	DistanceFromLastStop float64
@@ -90,6 +118,7 @@ func (s *Stop) UnmarshalJSON(b []byte) error {
 
 	*s = Stop{
 		Station:              parsed.Station,
+		Status:               StopStatus(parsed.Info.Status),
 		Platform:             parsed.Track.Scheduled,
 		DistanceFromStart:    float64(parsed.Info.DistanceFromStart) / 1000.0,
 		DistanceFromLastStop: float64(parsed.Info.Distance) / 1000.0,
@@ -107,6 +136,12 @@ func (s *Stop) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// ValidTime returns true if t is set. The portal reports missing times as
+// null, which is decoded as the Unix epoch.
+func ValidTime(t time.Time) bool {
+	return t.Unix() > 0
+}
+
 // Delay returns the estimated delay of arrival for upcoming stops and the
 // actual delay of departure for past stops.
 func (s Stop) Delay() time.Duration {
@@ -127,6 +162,9 @@ func (s Stop) ETA() time.Duration {
 }
 
 func (s Stop) String() string {
+	if s.Status == StopCancelled {
+		return fmt.Sprintf("%v (cancelled)", s.Station)
+	}
 	return fmt.Sprintf("%v P:%s (%.0fm delay)", s.Station, s.Platform, s.Delay().Minutes())
 }
 
@@ -143,6 +181,9 @@ type Trip struct {
 	Stops                []*Stop
 	NextStop             *Stop
 	PreviousStop         *Stop
+	// Connection is the onward connection selected by the passenger, if
+	// any.
+	Connection *Connection
 }
 
 // UnmarshalJSON implements the encoding/json.Unmarshaler interface.
@@ -165,7 +206,12 @@ func (t *Trip) UnmarshalJSON(b []byte) error {
 			TotalDistance int
 			Stops         []*Stop
 		}
-		// TODO(octo): connection, selectedRoute
+		Connection    *Connection
+		SelectedRoute struct {
+			ConflictInfo struct {
+				Status string
+			}
+		}
 	}
 
 	if err := json.Unmarshal(b, &parsed); err != nil {
@@ -179,6 +225,11 @@ func (t *Trip) UnmarshalJSON(b []byte) error {
 		DistanceFromLastStop: float64(parsed.Trip.DistanceFromLastStop) / 1000.0,
 		TotalDistance:        float64(parsed.Trip.TotalDistance) / 1000.0,
 		Stops:                parsed.Trip.Stops,
+		Connection:           parsed.Connection,
+	}
+
+	if t.Connection != nil {
+		t.Connection.Conflict = parsed.SelectedRoute.ConflictInfo.Status
 	}
 
 	t.Date, _ = time.Parse("2006-01-02", parsed.Trip.TripDate)
@@ -202,6 +253,9 @@ func (t *Trip) findStop(evaNr string) *Stop {
 // This function uses a submatch to find a matching station, so that you can
 // specify a city name, e.g. "Basel", and don't have to specify the exact
 // station name, e.g. "Basel Bad Bf".
+//
+// Deprecated: LookupStop also matches EVA numbers, ignores case and
+// diacritics and reports ambiguous queries.
 func (t *Trip) FindStop(name string) (*Stop, bool) {
 	for _, stop := range t.Stops {
 		if strings.Contains(stop.Station.Name, name) {
@@ -225,24 +279,27 @@ func (t *Trip) DistanceTo(s *Stop) float64 {
 	return s.DistanceFromStart - t.DistanceFromStart()
 }
 
-// TripInfo calls the tripInfo API and returns the parsed data.
-func TripInfo(ctx context.Context) (*Trip, error) {
-	req, err := http.NewRequest(http.MethodGet, TripInfoURL, nil)
-	if err != nil {
-		return nil, err
+// Extrapolate returns a copy of t with the train's position advanced by the
+// distance covered in d at a speed of kmh km/h. This is useful to estimate
+// the current position when t is outdated. The position is not advanced
+// beyond the next stop.
+func (t *Trip) Extrapolate(kmh float64, d time.Duration) *Trip {
+	c := *t
+	if kmh <= 0 || d <= 0 {
+		return &c
 	}
-	req = req.WithContext(ctx)
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	c.DistanceFromLastStop += kmh * d.Hours()
+	if t.NextStop != nil {
+		if max := t.NextStop.DistanceFromStart - (t.DistanceFromStart() - t.DistanceFromLastStop); c.DistanceFromLastStop > max {
+			c.DistanceFromLastStop = max
+		}
 	}
-	defer res.Body.Close()
 
-	var t Trip
-	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
-		return nil, err
-	}
+	return &c
+}
 
-	return &t, nil
+// TripInfo calls the tripInfo API using DefaultClient and returns the parsed data.
+func TripInfo(ctx context.Context) (*Trip, error) {
+	return DefaultClient.Trip(ctx)
 }
@@ -414,3 +414,119 @@ func TestTrip(t *testing.T) {
 		t.Errorf("trip.DistanceTo(%v) = %g, want %g", trip.Stops[10], got, want)
 	}
 }
+
+func TestTripExtrapolate(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	approxFloat := cmpopts.EquateApprox(0, .001)
+	munich := trip.Stops[10]
+
+	// 3 minutes at 200 km/h are 10 km.
+	got := trip.Extrapolate(200, 3*time.Minute)
+	if want := trip.DistanceTo(munich) - 10; !cmp.Equal(got.DistanceTo(munich), want, approxFloat) {
+		t.Errorf("Extrapolate(200, 3m).DistanceTo(%v) = %g, want %g", munich, got.DistanceTo(munich), want)
+	}
+	if got, want := trip.DistanceFromLastStop, 136.911; !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Extrapolate() modified the original trip: DistanceFromLastStop = %g, want %g", got, want)
+	}
+
+	// The position is not advanced past the next stop.
+	got = trip.Extrapolate(200, time.Hour)
+	if got, want := got.DistanceTo(munich), 0.0; !cmp.Equal(got, want, approxFloat) {
+		t.Errorf("Extrapolate(200, 1h).DistanceTo(%v) = %g, want %g", munich, got, want)
+	}
+}
+
+func TestLookupStop(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	cases := []struct {
+		query string
+		want  string // EVA number of the expected stop
+	}{
+		{"München", "8000261_00"},
+		{"Muenchen", "8000261_00"},
+		{"munchen", "8000261_00"},
+		{"MÜNCHEN HBF", "8000261_00"},
+		{"8000261", "8000261_00"},
+		{"8000261_00", "8000261_00"},
+		{"Bonn", "8005556_00"},
+		{"Nuernberg", "8000284_00"},
+		{"Frankfurt (Main) Hbf", "8000105_00"},
+		{"Flughafen", "8070003_00"},
+		// A word prefix is preferred over a substring.
+		{"Limb", "8003680_00"},
+	}
+
+	for _, c := range cases {
+		got, err := trip.LookupStop(c.query)
+		if err != nil {
+			t.Errorf("LookupStop(%q) = %v", c.query, err)
+			continue
+		}
+		if got.Station.ID != c.want {
+			t.Errorf("LookupStop(%q) = %v (%s), want %s", c.query, got, got.Station.ID, c.want)
+		}
+	}
+
+	_, err := trip.LookupStop("Frankfurt")
+	ambiguous, ok := err.(*AmbiguousStopError)
+	if !ok {
+		t.Fatalf("LookupStop(%q) = %v, want *AmbiguousStopError", "Frankfurt", err)
+	}
+	if got, want := len(ambiguous.Candidates), 2; got != want {
+		t.Errorf("len(Candidates) = %d, want %d", got, want)
+	}
+
+	_, err = trip.LookupStop("Wurzbrug")
+	notFound, ok := err.(*StopNotFoundError)
+	if !ok {
+		t.Fatalf("LookupStop(%q) = %v, want *StopNotFoundError", "Wurzbrug", err)
+	}
+	if len(notFound.Suggestions) == 0 || notFound.Suggestions[0].Station.ID != "8000260_00" {
+		t.Errorf("LookupStop(%q).Suggestions = %v, want Würzburg Hbf first", "Wurzbrug", notFound.Suggestions)
+	}
+
+	_, err = trip.LookupStop("Hamburg")
+	if notFound, ok = err.(*StopNotFoundError); !ok {
+		t.Fatalf("LookupStop(%q) = %v, want *StopNotFoundError", "Hamburg", err)
+	}
+	if len(notFound.Suggestions) != 0 {
+		t.Errorf("LookupStop(%q).Suggestions = %v, want none", "Hamburg", notFound.Suggestions)
+	}
+}
+
+func TestStopStatus(t *testing.T) {
+	var trip Trip
+	if err := json.Unmarshal([]byte(inputStr), &trip); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	for _, s := range trip.Stops {
+		if s.Status != StopNormal {
+			t.Errorf("%v: Status = %v, want %v", s.Station, s.Status, StopNormal)
+		}
+	}
+
+	cases := []struct {
+		input string
+		want  StopStatus
+	}{
+		{`{"station": {"evaNr": "8000284_00", "name": "Nürnberg Hbf"}, "info": {"status": 1}}`, StopAdditional},
+		{`{"station": {"evaNr": "8000284_00", "name": "Nürnberg Hbf"}, "info": {"status": 2}}`, StopCancelled},
+	}
+	for _, c := range cases {
+		var s Stop
+		if err := json.Unmarshal([]byte(c.input), &s); err != nil {
+			t.Fatalf("json.Unmarshal failed: %v", err)
+		}
+		if s.Status != c.want {
+			t.Errorf("Status = %v, want %v", s.Status, c.want)
+		}
+	}
+}
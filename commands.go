@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of icestat, e.g. "watch". Each command has its own
+// flag.FlagSet: flags registers the command's flags on it and run is called
+// once the arguments have been parsed. run returns the exit status.
+type command struct {
+	name  string
+	args  string
+	short string
+	long  string
+	flags func(fs *flag.FlagSet)
+	run   func(fs *flag.FlagSet) int
+}
+
+// defaultCommand is run if icestat is called without a command, e.g.
+// "icestat -destination München".
+const defaultCommand = "watch"
+
+var commands = []*command{
+	{
+		name:  "watch",
+		short: "report the train's progress until interrupted (default)",
+		long: "Reports the train's position, speed and arrival at the destinations every -interval and prints\n" +
+			"a summary of the trip on exit. Sending SIGUSR1 prints the summary so far.",
+		flags: func(fs *flag.FlagSet) {
+			pollFlags(fs)
+			destinationFlags(fs)
+			outputFlags(fs)
+			serverFlags(fs, "")
+		},
+		run: runWatch,
+	},
+	{
+		name:  "stops",
+		short: "list the stops of the trip",
+		long:  "Retrieves the trip once and lists its stops with scheduled and actual times, delay and platform.",
+		flags: portalFlags,
+		run:   runStops,
+	},
+	{
+		name:  "status",
+		short: "report the train's progress once",
+		long:  "Retrieves the trip and status once and prints them like \"watch\" does.",
+		flags: func(fs *flag.FlagSet) {
+			portalFlags(fs)
+			destinationFlags(fs)
+		},
+		run: runStatus,
+	},
+	{
+		name:  "record",
+		args:  "<dir>",
+		short: "record the portal's responses for later analysis",
+		long: "Polls the portal every -interval and appends its responses to a file per trip in <dir>.\n" +
+			"Recordings can be analyzed with \"stats\", \"replay\" and \"export\".",
+		flags: pollFlags,
+		run:   runRecord,
+	},
+	{
+		name:  "replay",
+		args:  "<recording>...",
+		short: "replay recorded trips",
+		long: "Passes recorded trips through the same processing as \"watch\", e.g. to try out alarms,\n" +
+			"webhooks or the dashboard. Recordings may be files or directories.",
+		flags: func(fs *flag.FlagSet) {
+			replayFlags(fs)
+			destinationFlags(fs)
+			outputFlags(fs)
+			serverFlags(fs, "")
+		},
+		run: runReplay,
+	},
+	{
+		name:  "serve",
+		short: "serve the train's state via HTTP",
+		long:  "Polls the portal every -interval and serves the train's state, API and dashboard via HTTP.",
+		flags: func(fs *flag.FlagSet) {
+			pollFlags(fs)
+			destinationFlags(fs)
+			serverFlags(fs, "localhost:8080")
+		},
+		run: runServe,
+	},
+	{
+		name:  "stats",
+		args:  "<recording>...",
+		short: "report punctuality across recorded trips",
+		long: "Reports the punctuality of recorded trips by train, route segment, station, weekday and hour.\n" +
+			"Recordings may be files or directories.",
+		flags: statsFlags,
+		run:   runStats,
+	},
+	{
+		name:  "export",
+		args:  "<recording>",
+		short: "convert a recorded trip to GPX, GeoJSON or KML",
+		long:  "Writes the track and stops of a recorded trip in the format selected with -format.",
+		flags: exportFlags,
+		run:   runExport,
+	},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the command's flag set, with a usage message including the
+// command's description.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		w := os.Stderr
+		fmt.Fprintf(w, "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n",
+			os.Args[0], cmd.name, cmd.args, cmd.long)
+		fs.PrintDefaults()
+	}
+	cmd.flags(fs)
+	return fs
+}
+
+// main parses args, the arguments following the command name, and runs the
+// command.
+func (cmd *command) main(args []string) int {
+	fs := cmd.flagSet()
+	fs.Parse(args)
+	return cmd.run(fs)
+}
+
+func usage() {
+	w := os.Stderr
+	fmt.Fprintf(w, "Usage: %s [command] [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(w, "\nWithout a command, %q is run. Run \"%s help <command>\" for the command's flags.\n",
+		defaultCommand, os.Args[0])
+}
+
+func main() {
+	args := os.Args[1:]
+	name := defaultCommand
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) != 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		// "icestat -h" lists the commands, "icestat watch -h" the
+		// flags of the watch command.
+		usage()
+		return
+	}
+
+	switch name {
+	case "help":
+		if len(args) == 0 {
+			usage()
+			return
+		}
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+			usage()
+			os.Exit(2)
+		}
+		cmd.flagSet().Usage()
+		return
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.main(args))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// parseDeparture parses the departure time passed to -connection, either in
+// RFC 3339 format or as "15:04". The latter refers to the first such time
+// after arrival, the scheduled arrival time at the transfer station.
+func parseDeparture(s string, arrival time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid departure time %q, want \"15:04\" or RFC 3339", s)
+	}
+
+	a := arrival.Local()
+	t := time.Date(a.Year(), a.Month(), a.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	// Allow for arriving late: a departure up to an hour before the
+	// scheduled arrival refers to the same day.
+	if t.Before(a.Add(-time.Hour)) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// findTransfer returns the transfer at the destination to the departure set
+// with -connection or, if that flag is not set, to the connection selected in
+// the portal.
+func findTransfer(trip *bahn.Trip) (bahn.Transfer, bool) {
+	if connection == "" {
+		return trip.Transfer()
+	}
+
+	dst, err := finalDestination(trip)
+	if err != nil {
+		return bahn.Transfer{}, false
+	}
+	departure, err := parseDeparture(connection, dst.ScheduledArrival)
+	if err != nil {
+		return bahn.Transfer{}, false
+	}
+
+	return bahn.Transfer{Stop: dst, Departure: departure}, true
+}
+
+// transferMessage describes the risk of missing tr.
+func transferMessage(tr bahn.Transfer, risk bahn.TransferRisk) string {
+	switch risk {
+	case bahn.TransferMissed:
+		return fmt.Sprintf("connection at %s will be missed: arriving %.0f min after the departure",
+			tr.Stop.Station, -tr.Buffer().Minutes())
+	case bahn.TransferTight:
+		return fmt.Sprintf("connection at %s is at risk: %.0f min to change trains",
+			tr.Stop.Station, tr.Buffer().Minutes())
+	}
+	return fmt.Sprintf("connection at %s is safe: %.0f min to change trains",
+		tr.Stop.Station, tr.Buffer().Minutes())
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// dashboardStop is a stop as sent to the dashboard.
+type dashboardStop struct {
+	Name             string    `json:"name"`
+	EvaNr            string    `json:"evaNr"`
+	Latitude         float64   `json:"lat"`
+	Longitude        float64   `json:"lon"`
+	Platform         string    `json:"platform"`
+	Passed           bool      `json:"passed"`
+	Next             bool      `json:"next"`
+	Cancelled        bool      `json:"cancelled"`
+	Distance         float64   `json:"distance_km"`
+	DelayMinutes     float64   `json:"delay_minutes"`
+	ScheduledArrival time.Time `json:"scheduled_arrival,omitempty"`
+	ActualArrival    time.Time `json:"actual_arrival,omitempty"`
+}
+
+// dashboardPoint is a position sample as sent to the dashboard.
+type dashboardPoint struct {
+	Latitude  float64   `json:"lat"`
+	Longitude float64   `json:"lon"`
+	Speed     float64   `json:"speed_kmh"`
+	Time      time.Time `json:"time"`
+}
+
+// dashboardState is the data sent to the dashboard on every update.
+type dashboardState struct {
+	Train   string           `json:"train"`
+	Updated time.Time        `json:"updated"`
+	Stops   []dashboardStop  `json:"stops"`
+	Track   []dashboardPoint `json:"track"`
+}
+
+func newDashboardState(trip *bahn.Trip, tr *track) *dashboardState {
+	st := &dashboardState{
+		Stops: []dashboardStop{},
+		Track: []dashboardPoint{},
+	}
+
+	for _, p := range tr.points {
+		st.Track = append(st.Track, dashboardPoint{
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			Speed:     p.Speed,
+			Time:      p.ServerTime,
+		})
+		st.Updated = p.ServerTime
+	}
+
+	if trip == nil {
+		return st
+	}
+	st.Train = tripName(trip)
+
+	for _, stop := range trip.Stops {
+		ds := dashboardStop{
+			Name:         stop.Station.Name,
+			EvaNr:        stop.Station.ID,
+			Latitude:     stop.Station.Latitude,
+			Longitude:    stop.Station.Longitude,
+			Platform:     stop.Platform,
+			Passed:       stop.Passed,
+			Next:         stop == trip.NextStop,
+			Cancelled:    stop.Status == bahn.StopCancelled,
+			DelayMinutes: stop.Delay().Minutes(),
+		}
+		if !stop.Passed {
+			ds.Distance = trip.DistanceTo(stop)
+		}
+		if bahn.ValidTime(stop.ScheduledArrival) {
+			ds.ScheduledArrival = stop.ScheduledArrival
+			ds.ActualArrival = stop.ActualArrival
+		}
+
+		st.Stops = append(st.Stops, ds)
+	}
+
+	return st
+}
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardHTML)
+}
+
+// positionInterval is the interval in which the estimated position is sent
+// to the dashboard.
+const positionInterval = time.Second
+
+// handleEvents streams the dashboard state as Server-Sent Events. A "state"
+// event is sent immediately and after every update of the poll loop. In
+// between, "position" events carry the estimated position of the train.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	position := time.NewTicker(positionInterval)
+	defer position.Stop()
+
+	for {
+		// Subscribe before taking the snapshot, so no update is missed.
+		changed := s.state.wait()
+
+		data, err := json.Marshal(newDashboardState(s.state.snapshot()))
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: state\ndata: %s\n\n", data)
+		flusher.Flush()
+
+	wait:
+		for {
+			select {
+			case <-changed:
+				break wait
+			case t := <-position.C:
+				p := s.state.estimate(t)
+				if p == nil {
+					fmt.Fprint(w, ": keepalive\n\n")
+				} else if data, err := json.Marshal(p); err == nil {
+					fmt.Fprintf(w, "event: position\ndata: %s\n\n", data)
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-s.quit:
+				return
+			}
+		}
+	}
+}
+
+// dashboardHTML is the single-page dashboard. It is self-contained, so it
+// works without internet access beyond the train's wifi.
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>icestat</title>
+<style>
+  body { font-family: sans-serif; margin: 0; padding: 0.5em; background: #f5f5f5; color: #222; }
+  h1 { font-size: 1.3em; margin: 0.2em 0; }
+  .meta { color: #666; font-size: 0.9em; }
+  .panel { background: #fff; border-radius: 6px; padding: 0.5em; margin: 0.5em 0; box-shadow: 0 1px 3px rgba(0,0,0,0.15); }
+  svg { width: 100%; height: auto; display: block; }
+  table { width: 100%; border-collapse: collapse; font-size: 0.9em; }
+  th, td { text-align: left; padding: 0.25em; border-bottom: 1px solid #eee; }
+  td.num { text-align: right; }
+  tr.passed { color: #999; }
+  tr.next { font-weight: bold; }
+  tr.cancelled { text-decoration: line-through; color: #999; }
+  .late { color: #c00; }
+  .stale { color: #c60; }
+  @media (min-width: 900px) {
+    main { display: grid; grid-template-columns: 1fr 1fr; grid-gap: 0.5em; }
+  }
+</style>
+</head>
+<body>
+<h1 id="train">icestat</h1>
+<div class="meta"><span id="speed">–</span> km/h · updated <span id="updated">never</span></div>
+<main>
+  <div>
+    <div class="panel"><svg id="map" viewBox="0 0 400 300"></svg></div>
+    <div class="panel"><svg id="chart" viewBox="0 0 400 120"></svg></div>
+  </div>
+  <div class="panel">
+    <table>
+      <thead><tr><th>Station</th><th>Pl.</th><th class="num">Arr.</th><th class="num">Delay</th><th class="num">km</th></tr></thead>
+      <tbody id="stops"></tbody>
+    </table>
+  </div>
+</main>
+<script>
+"use strict";
+var SVG = "http://www.w3.org/2000/svg";
+
+function el(name, attrs, text) {
+  var e = document.createElementNS(SVG, name);
+  for (var k in attrs) e.setAttribute(k, attrs[k]);
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function clock(s) {
+  if (!s || s.indexOf("0001-") === 0) return "";
+  var d = new Date(s);
+  return ("0" + d.getHours()).slice(-2) + ":" + ("0" + d.getMinutes()).slice(-2);
+}
+
+function drawMap(st) {
+  var svg = document.getElementById("map");
+  while (svg.firstChild) svg.removeChild(svg.firstChild);
+
+  var pts = st.stops.map(function(s) { return [s.lat, s.lon]; })
+    .concat(st.track.map(function(p) { return [p.lat, p.lon]; }));
+  if (pts.length === 0) return;
+
+  var minLat = Infinity, maxLat = -Infinity, minLon = Infinity, maxLon = -Infinity;
+  pts.forEach(function(p) {
+    minLat = Math.min(minLat, p[0]); maxLat = Math.max(maxLat, p[0]);
+    minLon = Math.min(minLon, p[1]); maxLon = Math.max(maxLon, p[1]);
+  });
+  var k = Math.cos((minLat + maxLat) / 2 * Math.PI / 180);
+  var w = Math.max((maxLon - minLon) * k, 0.01), h = Math.max(maxLat - minLat, 0.01);
+  var scale = Math.min(360 / w, 260 / h);
+  function xy(lat, lon) {
+    return [20 + ((lon - minLon) * k) * scale, 280 - (lat - minLat) * scale];
+  }
+
+  var route = st.stops.map(function(s) { return xy(s.lat, s.lon).join(","); }).join(" ");
+  svg.appendChild(el("polyline", {points: route, fill: "none", stroke: "#bbb", "stroke-width": 2, "stroke-dasharray": "4 3"}));
+
+  var track = st.track.map(function(p) { return xy(p.lat, p.lon).join(","); }).join(" ");
+  svg.appendChild(el("polyline", {points: track, fill: "none", stroke: "#d00", "stroke-width": 3}));
+
+  st.stops.forEach(function(s) {
+    var p = xy(s.lat, s.lon);
+    svg.appendChild(el("circle", {cx: p[0], cy: p[1], r: 4, fill: s.passed ? "#999" : "#06c"}));
+    svg.appendChild(el("text", {x: p[0] + 6, y: p[1] + 4, "font-size": 10}, s.name));
+  });
+
+  var train = el("circle", {id: "train-marker", r: 7, fill: "#d00", stroke: "#fff", "stroke-width": 2});
+  train.setAttribute("visibility", "hidden");
+  svg.appendChild(train);
+  project = xy;
+
+  if (st.track.length > 0) {
+    var last = st.track[st.track.length - 1];
+    moveTrain(last.lat, last.lon);
+  }
+}
+
+var project = null;
+
+function moveTrain(lat, lon) {
+  var m = document.getElementById("train-marker");
+  if (!m || !project) return;
+  var p = project(lat, lon);
+  m.setAttribute("cx", p[0]);
+  m.setAttribute("cy", p[1]);
+  m.setAttribute("visibility", "visible");
+}
+
+// renderPosition updates the train marker and the next stop's distance with
+// the position estimated between polls.
+function renderPosition(pos) {
+  moveTrain(pos.latitude, pos.longitude);
+  var row = document.querySelector("tr.next");
+  if (row && pos.next_stop) {
+    row.lastChild.textContent = pos.next_stop_distance_km.toFixed(1);
+  }
+}
+
+function drawChart(st) {
+  var svg = document.getElementById("chart");
+  while (svg.firstChild) svg.removeChild(svg.firstChild);
+  if (st.track.length < 2) return;
+
+  var t0 = Date.parse(st.track[0].time), t1 = Date.parse(st.track[st.track.length - 1].time);
+  var maxSpeed = Math.max(100, Math.max.apply(null, st.track.map(function(p) { return p.speed_kmh; })));
+  function xy(p) {
+    return [30 + (Date.parse(p.time) - t0) / Math.max(t1 - t0, 1) * 360, 110 - p.speed_kmh / maxSpeed * 100];
+  }
+
+  [0, 0.5, 1].forEach(function(f) {
+    var y = 110 - f * 100;
+    svg.appendChild(el("line", {x1: 30, x2: 390, y1: y, y2: y, stroke: "#eee"}));
+    svg.appendChild(el("text", {x: 0, y: y + 4, "font-size": 10}, Math.round(f * maxSpeed)));
+  });
+  svg.appendChild(el("polyline", {points: st.track.map(function(p) { return xy(p).join(","); }).join(" "),
+    fill: "none", stroke: "#06c", "stroke-width": 2}));
+}
+
+function drawStops(st) {
+  var body = document.getElementById("stops");
+  while (body.firstChild) body.removeChild(body.firstChild);
+
+  st.stops.forEach(function(s) {
+    var tr = document.createElement("tr");
+    tr.className = s.cancelled ? "cancelled" : (s.passed ? "passed" : (s.next ? "next" : ""));
+    var delay = Math.round(s.delay_minutes);
+    [s.name, s.platform, clock(s.actual_arrival), delay > 0 ? "+" + delay : String(delay),
+     s.passed ? "" : s.distance_km.toFixed(0)].forEach(function(v, i) {
+      var td = document.createElement("td");
+      td.textContent = v;
+      if (i >= 2) td.className = "num";
+      if (i === 3 && delay > 0) td.className += " late";
+      tr.appendChild(td);
+    });
+    body.appendChild(tr);
+  });
+}
+
+function render(st) {
+  document.getElementById("train").textContent = st.train || "icestat";
+  if (st.track.length > 0) {
+    document.getElementById("speed").textContent = Math.round(st.track[st.track.length - 1].speed_kmh);
+  }
+  document.getElementById("updated").textContent = clock(st.updated) || "never";
+  drawMap(st);
+  drawChart(st);
+  drawStops(st);
+}
+
+var events = new EventSource("events");
+events.addEventListener("state", function(e) { render(JSON.parse(e.data)); });
+events.addEventListener("position", function(e) { renderPosition(JSON.parse(e.data)); });
+events.onerror = function() { document.getElementById("updated").className = "stale"; };
+events.onopen = function() { document.getElementById("updated").className = ""; };
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// Kinds of events detected by eventDetector.
+const (
+	eventDeparted        = "departed"
+	eventArrivingSoon    = "arriving_soon"
+	eventArrived         = "arrived"
+	eventDelayChanged    = "delay_changed"
+	eventPlatformChanged = "platform_changed"
+	eventConnectionRisk  = "connection_at_risk"
+	eventTripChanged     = "trip_changed"
+	eventStopCancelled   = "stop_cancelled"
+)
+
+// arrivalDistance is the distance, in kilometers, from a stop below which the
+// train is considered to have arrived.
+const arrivalDistance = 0.5
+
+// arrivingSoon is the time before the expected arrival at the next stop or a
+// destination at which an eventArrivingSoon is emitted.
+const arrivingSoon = 5 * time.Minute
+
+// event is a noteworthy change of the trip, e.g. the train departing from a
+// station or the platform of a stop changing.
+type event struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Train   string    `json:"train"`
+	EvaNr   string    `json:"eva_nr,omitempty"`
+	Station string    `json:"station,omitempty"`
+	Message string    `json:"message"`
+	Old     string    `json:"old,omitempty"`
+	New     string    `json:"new,omitempty"`
+}
+
+// eventDetector derives events by comparing consecutive trip updates.
+type eventDetector struct {
+	lastID   int
+	prev     *bahn.Trip
+	arriving map[string]bool
+	arrived  map[string]bool
+	// risk is the risk of missing the connection at the previous update.
+	risk bahn.TransferRisk
+}
+
+// detect returns the events that occurred between the previous update and u.
+func (d *eventDetector) detect(u *update) []event {
+	if u.Trip == nil {
+		return nil
+	}
+	trip := u.Trip
+
+	var events []event
+	add := func(kind string, stop *bahn.Stop, msg string, old, new string) {
+		d.lastID++
+		e := event{
+			ID:      d.lastID,
+			Time:    u.Time,
+			Kind:    kind,
+			Train:   tripName(trip),
+			Message: msg,
+			Old:     old,
+			New:     new,
+		}
+		if stop != nil {
+			e.EvaNr = stop.Station.ID
+			e.Station = stop.Station.Name
+		}
+		events = append(events, e)
+	}
+
+	// Warn if a destination was cancelled or dropped from the route. This
+	// compares with the previous update, so it has to happen before the
+	// state of a new trip is reset.
+	if d.prev != nil && sameTrip(d.prev, trip) {
+		if dsts, err := findDestinations(d.prev); err == nil {
+			for _, dst := range dsts {
+				stop := stopByID(trip, dst.Station.ID)
+				if stop == nil {
+					add(eventStopCancelled, dst, fmt.Sprintf("%s was dropped from the route", dst.Station),
+						dst.Status.String(), "")
+				} else if stop.Status == bahn.StopCancelled && dst.Status != bahn.StopCancelled {
+					add(eventStopCancelled, stop, fmt.Sprintf("the stop at %s was cancelled", stop.Station),
+						dst.Status.String(), stop.Status.String())
+				}
+			}
+		}
+	}
+
+	// A new trip, e.g. after changing trains, is not compared to the old one.
+	if d.prev != nil && !sameTrip(d.prev, trip) {
+		msg := fmt.Sprintf("changed trains from %s to %s", tripName(d.prev), tripName(trip))
+		if sameTrain(d.prev, trip) {
+			msg = fmt.Sprintf("the trip of %s was reset", tripName(trip))
+		}
+		add(eventTripChanged, nil, msg, tripName(d.prev), tripName(trip))
+		d.prev = nil
+		d.arrived = nil
+		d.risk = bahn.TransferOK
+	}
+	if d.arrived == nil {
+		d.arriving = make(map[string]bool)
+		d.arrived = make(map[string]bool)
+	}
+
+	watched := map[*bahn.Stop]bool{
+		trip.NextStop: true,
+	}
+	if dsts, err := findDestinations(trip); err == nil {
+		for _, dst := range dsts {
+			watched[dst] = dst.Status != bahn.StopCancelled
+		}
+	}
+
+	for _, stop := range trip.Stops {
+		if watched[stop] && !stop.Passed && !d.arriving[stop.Station.ID] && bahn.ValidTime(stop.ActualArrival) &&
+			stop.ActualArrival.Sub(u.Time) <= arrivingSoon {
+			d.arriving[stop.Station.ID] = true
+			add(eventArrivingSoon, stop, fmt.Sprintf("arriving at %s on platform %s at %s",
+				stop.Station, stop.Platform, formatClock(stop.ActualArrival)), "", "")
+		}
+
+		if !stop.Passed && !d.arrived[stop.Station.ID] && trip.DistanceTo(stop) < arrivalDistance &&
+			!u.Time.Before(stop.ActualArrival) {
+			d.arrived[stop.Station.ID] = true
+			add(eventArrived, stop, fmt.Sprintf("arrived at %s", stop.Station), "", "")
+		}
+
+		if d.prev == nil {
+			continue
+		}
+		prevStop := stopByID(d.prev, stop.Station.ID)
+		if prevStop == nil {
+			continue
+		}
+
+		if stop.Passed && !prevStop.Passed {
+			add(eventDeparted, stop, fmt.Sprintf("departed from %s", stop.Station), "", "")
+		}
+		if stop.Passed {
+			continue
+		}
+
+		if stop.Platform != prevStop.Platform {
+			add(eventPlatformChanged, stop,
+				fmt.Sprintf("platform at %s changed from %s to %s", stop.Station, prevStop.Platform, stop.Platform),
+				prevStop.Platform, stop.Platform)
+		}
+
+		if watched[stop] && stop.Delay() != prevStop.Delay() {
+			add(eventDelayChanged, stop,
+				fmt.Sprintf("delay at %s changed from %s to %s", stop.Station,
+					formatDelay(prevStop.Delay()), formatDelay(stop.Delay())),
+				fmt.Sprintf("%.0f", prevStop.Delay().Minutes()), fmt.Sprintf("%.0f", stop.Delay().Minutes()))
+		}
+	}
+
+	if tr, ok := findTransfer(trip); ok && !tr.Stop.Passed {
+		risk := tr.Risk(minTransfer)
+		if risk > d.risk {
+			add(eventConnectionRisk, tr.Stop, transferMessage(tr, risk), d.risk.String(), risk.String())
+		}
+		d.risk = risk
+	}
+
+	d.prev = trip
+	return events
+}
+
+// sameTrip returns true if a and b are the same trip, i.e. the same train on
+// the same day on the same route. Stops being added to or removed from the
+// route don't make a new trip, but a different origin and final stop do, e.g.
+// when the portal was reset for the train's next trip.
+func sameTrip(a, b *bahn.Trip) bool {
+	if !sameTrain(a, b) {
+		return false
+	}
+	if len(a.Stops) == 0 || len(b.Stops) == 0 {
+		return true
+	}
+
+	sameOrigin := a.Stops[0].Station.ID == b.Stops[0].Station.ID
+	sameFinal := a.Stops[len(a.Stops)-1].Station.ID == b.Stops[len(b.Stops)-1].Station.ID
+	return sameOrigin || sameFinal
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// testTrip returns a trip of ICE 521 serving stops with the given IDs, which
+// double as station names.
+func testTrip(ids ...string) *bahn.Trip {
+	trip := &bahn.Trip{
+		TrainType: "ICE",
+		TrainID:   "521",
+		Date:      time.Date(2018, 8, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for _, id := range ids {
+		trip.Stops = append(trip.Stops, &bahn.Stop{
+			Station: &bahn.Station{ID: id, Name: id},
+		})
+	}
+	return trip
+}
+
+func TestSameTrip(t *testing.T) {
+	otherTrain := testTrip("a", "b", "c")
+	otherTrain.TrainID = "523"
+	nextDay := testTrip("a", "b", "c")
+	nextDay.Date = nextDay.Date.AddDate(0, 0, 1)
+
+	cases := []struct {
+		name string
+		b    *bahn.Trip
+		want bool
+	}{
+		{"identical", testTrip("a", "b", "c"), true},
+		{"dropped stop", testTrip("a", "c"), true},
+		{"additional stop", testTrip("a", "b", "x", "c"), true},
+		{"cut short", testTrip("a", "b"), true},
+		{"different route", testTrip("c", "b", "a"), false},
+		{"other train", otherTrain, false},
+		{"next day", nextDay, false},
+	}
+
+	for _, c := range cases {
+		if got := sameTrip(testTrip("a", "b", "c"), c.b); got != c.want {
+			t.Errorf("%s: sameTrip() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTrackSegments(t *testing.T) {
+	var tr track
+	add := func(lat float64) {
+		tr.add(&bahn.Status{Latitude: lat, Longitude: 11})
+	}
+
+	add(48)
+	add(49)
+	tr.split()
+	tr.split()
+	add(50)
+
+	segs := tr.segments()
+	if len(segs) != 2 || len(segs[0]) != 2 || len(segs[1]) != 1 {
+		t.Fatalf("segments() = %v, want two segments of 2 and 1 points", segs)
+	}
+	if got := segs[1][0].Latitude; got != 50 {
+		t.Errorf("second segment starts at latitude %g, want 50", got)
+	}
+}
+
+// eventsOf returns the events of kind in events.
+func eventsOf(events []event, kind string) []event {
+	var res []event
+	for _, e := range events {
+		if e.Kind == kind {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func TestDetectCancelledDestination(t *testing.T) {
+	defer func(saved stringList) { destinations = saved }(destinations)
+	destinations = stringList{"b", "c"}
+
+	cancelled := func() *bahn.Trip {
+		trip := testTrip("a", "b", "c")
+		trip.Stops[1].Status = bahn.StopCancelled
+		return trip
+	}
+
+	var d eventDetector
+	d.detect(&update{Trip: testTrip("a", "b", "c")})
+
+	events := d.detect(&update{Trip: cancelled()})
+	if got := eventsOf(events, eventTripChanged); len(got) != 0 {
+		t.Errorf("cancelling a stop caused %v", got)
+	}
+	got := eventsOf(events, eventStopCancelled)
+	if len(got) != 1 || got[0].EvaNr != "b" {
+		t.Fatalf("stop_cancelled events = %v, want one for b", got)
+	}
+
+	// The cancellation is reported once.
+	if got := eventsOf(d.detect(&update{Trip: cancelled()}), eventStopCancelled); len(got) != 0 {
+		t.Errorf("stop_cancelled events = %v, want none", got)
+	}
+
+	// The other destination is still watched.
+	dst, err := findDestination(cancelled())
+	if err != nil || dst.Station.ID != "c" {
+		t.Errorf("findDestination() = (%v, %v), want c", dst, err)
+	}
+	if err := validateDestinations(cancelled()); err == nil {
+		t.Error("validateDestinations() succeeded, want an error for the cancelled stop")
+	}
+}
+
+func TestDetectDroppedDestination(t *testing.T) {
+	defer func(saved stringList) { destinations = saved }(destinations)
+	destinations = stringList{"b", "c"}
+
+	var d eventDetector
+	d.detect(&update{Trip: testTrip("a", "b", "c")})
+
+	events := d.detect(&update{Trip: testTrip("a", "c")})
+	if got := eventsOf(events, eventTripChanged); len(got) != 0 {
+		t.Errorf("dropping a stop caused %v", got)
+	}
+	got := eventsOf(events, eventStopCancelled)
+	if len(got) != 1 || got[0].EvaNr != "b" {
+		t.Fatalf("stop_cancelled events = %v, want one for b", got)
+	}
+
+	// The remaining destination is still found.
+	stops, err := findDestinations(testTrip("a", "c"))
+	if err != nil || len(stops) != 1 || stops[0].Station.ID != "c" {
+		t.Errorf("findDestinations() = (%v, %v), want [c]", stops, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/octo/icestat/bahn"
+)
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoJSONPoint returns a GeoJSON position. Note that GeoJSON uses longitude,
+// latitude order.
+func geoJSONPoint(lat, lon float64) []float64 {
+	return []float64{lon, lat}
+}
+
+// writeGeoJSON writes trip and tr as a GeoJSON FeatureCollection to w. The
+// collection contains a LineString of the positions in tr per train, a Point for each
+// stop of the trip and a Point for the train's latest position. trip may be nil.
+func writeGeoJSON(w io.Writer, trip *bahn.Trip, tr *track) error {
+	fc := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+
+	name := ""
+	if trip != nil {
+		name = tripName(trip)
+	}
+
+	for _, points := range tr.segments() {
+		if len(points) < 2 {
+			continue
+		}
+		var coords [][]float64
+		for _, p := range points {
+			coords = append(coords, geoJSONPoint(p.Latitude, p.Longitude))
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONGeometry{
+				Type:        "LineString",
+				Coordinates: coords,
+			},
+			Properties: map[string]interface{}{
+				"kind":  "track",
+				"name":  name,
+				"start": points[0].ServerTime,
+				"end":   points[len(points)-1].ServerTime,
+			},
+		})
+	}
+
+	if trip != nil {
+		for _, stop := range trip.Stops {
+			props := map[string]interface{}{
+				"kind":                   "station",
+				"name":                   stop.Station.Name,
+				"evaNr":                  stop.Station.ID,
+				"platform":               stop.Platform,
+				"passed":                 stop.Passed,
+				"delay_minutes":          stop.Delay().Minutes(),
+				"distance_from_start_km": stop.DistanceFromStart,
+			}
+			if bahn.ValidTime(stop.ScheduledArrival) {
+				props["scheduled_arrival"] = stop.ScheduledArrival
+				props["actual_arrival"] = stop.ActualArrival
+			}
+			if bahn.ValidTime(stop.ScheduledDeparture) {
+				props["scheduled_departure"] = stop.ScheduledDeparture
+				props["actual_departure"] = stop.ActualDeparture
+			}
+
+			fc.Features = append(fc.Features, geoJSONFeature{
+				Type: "Feature",
+				Geometry: geoJSONGeometry{
+					Type:        "Point",
+					Coordinates: geoJSONPoint(stop.Station.Latitude, stop.Station.Longitude),
+				},
+				Properties: props,
+			})
+		}
+	}
+
+	if n := len(tr.points); n != 0 {
+		p := tr.points[n-1]
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONGeometry{
+				Type:        "Point",
+				Coordinates: geoJSONPoint(p.Latitude, p.Longitude),
+			},
+			Properties: map[string]interface{}{
+				"kind":      "position",
+				"name":      name,
+				"speed_kmh": p.Speed,
+				"time":      p.ServerTime,
+			},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(fc)
+}
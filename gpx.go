@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// gpxNamespace is the XML namespace of icestat's GPX extensions.
+const gpxNamespace = "https://github.com/octo/icestat/gpx/1"
+
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	XmlnsExt  string        `xml:"xmlns:icestat,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Metadata  gpxMetadata   `xml:"metadata"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Track     gpxTrack      `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+// gpxWaypoint is a station along the route. Scheduled and actual times are
+// stored as extensions, since GPX only has a single time per waypoint.
+type gpxWaypoint struct {
+	Latitude   float64              `xml:"lat,attr"`
+	Longitude  float64              `xml:"lon,attr"`
+	Time       string               `xml:"time,omitempty"`
+	Name       string               `xml:"name"`
+	Type       string               `xml:"type"`
+	Extensions gpxWaypointExtension `xml:"extensions"`
+}
+
+type gpxWaypointExtension struct {
+	EvaNr              string `xml:"icestat:evaNr"`
+	Platform           string `xml:"icestat:platform,omitempty"`
+	Passed             bool   `xml:"icestat:passed"`
+	ScheduledArrival   string `xml:"icestat:scheduledArrival,omitempty"`
+	ActualArrival      string `xml:"icestat:actualArrival,omitempty"`
+	ScheduledDeparture string `xml:"icestat:scheduledDeparture,omitempty"`
+	ActualDeparture    string `xml:"icestat:actualDeparture,omitempty"`
+	DistanceFromStart  string `xml:"icestat:distanceFromStart"`
+}
+
+type gpxTrack struct {
+	Name     string            `xml:"name,omitempty"`
+	Type     string            `xml:"type,omitempty"`
+	Segments []gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxTrackPoint `xml:"trkpt"`
+}
+
+type gpxTrackPoint struct {
+	Latitude   float64                `xml:"lat,attr"`
+	Longitude  float64                `xml:"lon,attr"`
+	Time       string                 `xml:"time,omitempty"`
+	Extensions gpxTrackPointExtension `xml:"extensions"`
+}
+
+type gpxTrackPointExtension struct {
+	// Speed is the speed in km/h.
+	Speed        string `xml:"icestat:speed"`
+	Connection   bool   `xml:"icestat:connection"`
+	ServiceLevel string `xml:"icestat:serviceLevel,omitempty"`
+}
+
+func gpxTime(t time.Time) string {
+	if !bahn.ValidTime(t) {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// tripName returns a short name of the trip, e.g. "ICE 521".
+func tripName(trip *bahn.Trip) string {
+	return trip.TrainType + " " + trip.TrainID
+}
+
+// writeGPX writes trip and tr as a GPX 1.1 document to w. Each stop of the
+// trip becomes a waypoint, the positions in tr become a track with a segment
+// per train. trip may be nil.
+func writeGPX(w io.Writer, trip *bahn.Trip, tr *track) error {
+	doc := gpxDocument{
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsExt: gpxNamespace,
+		Version:  "1.1",
+		Creator:  "icestat",
+		Track: gpxTrack{
+			Type: "train",
+		},
+	}
+
+	if len(tr.points) != 0 {
+		doc.Metadata.Time = gpxTime(tr.points[0].ServerTime)
+	}
+
+	if trip != nil {
+		doc.Metadata.Name = tripName(trip)
+		doc.Track.Name = tripName(trip)
+
+		for _, stop := range trip.Stops {
+			wpt := gpxWaypoint{
+				Latitude:  stop.Station.Latitude,
+				Longitude: stop.Station.Longitude,
+				Name:      stop.Station.Name,
+				Type:      "station",
+				Extensions: gpxWaypointExtension{
+					EvaNr:              stop.Station.ID,
+					Platform:           stop.Platform,
+					Passed:             stop.Passed,
+					ScheduledArrival:   gpxTime(stop.ScheduledArrival),
+					ActualArrival:      gpxTime(stop.ActualArrival),
+					ScheduledDeparture: gpxTime(stop.ScheduledDeparture),
+					ActualDeparture:    gpxTime(stop.ActualDeparture),
+					DistanceFromStart:  fmt.Sprintf("%.3f", stop.DistanceFromStart),
+				},
+			}
+
+			// The waypoint's time is the (expected) arrival, or the departure for the first stop.
+			wpt.Time = gpxTime(stop.ActualArrival)
+			if wpt.Time == "" {
+				wpt.Time = gpxTime(stop.ActualDeparture)
+			}
+
+			doc.Waypoints = append(doc.Waypoints, wpt)
+		}
+	}
+
+	for _, points := range tr.segments() {
+		var seg gpxTrackSegment
+		for _, p := range points {
+			seg.Points = append(seg.Points, gpxTrackPoint{
+				Latitude:  p.Latitude,
+				Longitude: p.Longitude,
+				Time:      gpxTime(p.ServerTime),
+				Extensions: gpxTrackPointExtension{
+					Speed:        fmt.Sprintf("%.1f", p.Speed),
+					Connection:   p.Connection,
+					ServiceLevel: p.ServiceLevel,
+				},
+			})
+		}
+		doc.Track.Segments = append(doc.Track.Segments, seg)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
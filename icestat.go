@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"os"
 	"sort"
 	"strings"
 	"time"
@@ -14,12 +15,119 @@ import (
 	"github.com/octo/icestat/bahn"
 )
 
+// Flags shared by several commands. They are registered on each command's
+// flag.FlagSet by the functions below.
 var (
-	interval    = flag.Duration("interval", 10*time.Second, "Interval in which to report statistics.")
-	count       = flag.Int("count", -1, "Number of iterations.")
-	destination = flag.String("destination", "", "Optional destination to anticipate.")
+	interval     time.Duration
+	count        int
+	destinations stringList
+
+	summaryMarkdown string
+	summaryJSON     string
+
+	gpxFile     string
+	geoJSONFile string
+	kmlFile     string
+
+	recordDir string
+
+	listen string
+	proxy  bool
+	portal string
+
+	routePath   string
+	journeyPath string
+
+	connection  string
+	minTransfer time.Duration
+
+	alarmBefore   time.Duration
+	alarmDistance float64
+	alarmDelay    time.Duration
+	notify        stringList
+
+	webhookURLs     stringList
+	webhookSecret   string
+	webhookMinDelay time.Duration
+
+	mqttURL    string
+	mqttPrefix string
+
+	retries    int
+	maxBackoff time.Duration
 )
 
+// portalFlags registers the flags for accessing the portal.
+func portalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&portal, "portal", bahn.DefaultBaseURL, "Base URL of the portal's API, e.g. of another icestat's -proxy.")
+	fs.IntVar(&retries, "retries", bahn.DefaultRetryPolicy.MaxAttempts, "Number of attempts for each request to the portal.")
+}
+
+// pollFlags registers the flags controlling the poll loop.
+func pollFlags(fs *flag.FlagSet) {
+	portalFlags(fs)
+	fs.DurationVar(&interval, "interval", 10*time.Second, "Interval in which to report statistics.")
+	fs.IntVar(&count, "count", -1, "Number of iterations.")
+	fs.DurationVar(&maxBackoff, "max-backoff", 5*time.Minute, "Maximum interval between polls while the portal is unreachable.")
+}
+
+// destinationFlags registers the flags selecting the stops to anticipate.
+func destinationFlags(fs *flag.FlagSet) {
+	fs.Var(&destinations, "destination", "Optional destination to anticipate. May be repeated to watch several stops.")
+	fs.Var(&destinations, "watch", "Alias for -destination.")
+	fs.StringVar(&journeyPath, "journey", "", "JSON file describing a journey across several trains. "+
+		"The destination of each train is taken from the journey.")
+	fs.StringVar(&connection, "connection", "", "Departure time of the onward train at the destination, e.g. \"14:32\". "+
+		"By default, the connection selected in the portal is used.")
+	fs.DurationVar(&minTransfer, "min-transfer", 5*time.Minute, "Time needed to change trains. Shorter transfers are reported as at risk.")
+	fs.StringVar(&routePath, "route", "", "GPX or GeoJSON file with the route's geometry, or a directory of GPX files recorded with -gpx, "+
+		"used to compute distances from the train's GPS position.")
+}
+
+// outputFlags registers the flags of the sinks updates are passed to.
+func outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&summaryMarkdown, "summary-markdown", "", "Write a trip summary in Markdown format to this file on exit.")
+	fs.StringVar(&summaryJSON, "summary-json", "", "Write a trip summary in JSON format to this file on exit.")
+
+	fs.StringVar(&gpxFile, "gpx", "", "Write the train's track and stops in GPX format to this file.")
+	fs.StringVar(&geoJSONFile, "geojson", "", "Write the train's track and stops in GeoJSON format to this file.")
+	fs.StringVar(&kmlFile, "kml", "", "Write the train's track and stops in KML format to this file.")
+
+	fs.StringVar(&recordDir, "record", "", "Directory to record the portal's responses to, one file per trip, for \"icestat stats\".")
+
+	fs.DurationVar(&alarmBefore, "alarm-before", 0, "Raise an alarm this long before arriving at the destinations.")
+	fs.Float64Var(&alarmDistance, "alarm-distance", 0, "Raise an alarm this many kilometers before arriving at the destinations.")
+	fs.DurationVar(&alarmDelay, "alarm-delay", 5*time.Minute, "Raise an alarm when the delay at a destination changes by at least this much.")
+	fs.Var(&notify, "notify", "Deliver alarms via \"bell\", \"exec:<command>\" or \"fifo:<path>\". May be repeated. "+
+		"Alarms are enabled by this flag, -alarm-before or -alarm-distance; the default is \"bell\".")
+
+	fs.Var(&webhookURLs, "webhook", "URL to POST trip events to as JSON. May be repeated.")
+	fs.StringVar(&webhookSecret, "webhook-secret", "", "Sign webhook requests with HMAC-SHA256 using this secret.")
+	fs.DurationVar(&webhookMinDelay, "webhook-min-delay", 5*time.Minute, "Send delay changes to webhooks only if the delay changed by at least this much.")
+
+	fs.StringVar(&mqttURL, "mqtt", "", "MQTT broker to publish the train's state to, e.g. \"tcp://localhost:1883\".")
+	fs.StringVar(&mqttPrefix, "mqtt-prefix", "icestat", "Prefix of the MQTT topics.")
+}
+
+// serverFlags registers the flags of the HTTP server. If defaultListen is
+// empty, the server is disabled by default.
+func serverFlags(fs *flag.FlagSet, defaultListen string) {
+	fs.StringVar(&listen, "listen", defaultListen, "Address to serve the current state on via HTTP, e.g. \"localhost:8080\".")
+	fs.BoolVar(&proxy, "proxy", false, "Serve the portal's API responses, cached for one interval, at their original paths. Requires -listen.")
+}
+
+// stringList is a flag.Value collecting the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 type speedDistribution struct {
 	data []float64
 }
@@ -75,114 +183,628 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.0f:%02.0f", h, m)
 }
 
-func printTrip(trip *bahn.Trip) error {
-	if len(trip.Stops) == 0 {
-		return errors.New("trip contains no stops")
+// destinationNames returns the stops selected with -destination or, if the
+// train is part of the journey passed to -journey, where the passenger
+// alights.
+func destinationNames(trip *bahn.Trip) []string {
+	if itinerary != nil {
+		if l := itinerary.leg(trip); l != nil {
+			return []string{l.To}
+		}
 	}
+	return destinations
+}
 
-	finalStop := trip.Stops[len(trip.Stops)-1]
-	nextStop := trip.NextStop
-	if nextStop == nil {
-		return fmt.Errorf("train arrived in %v", finalStop)
+// findDestinations returns the stops selected with -destination, in the order
+// the train serves them, or, if none was selected, the final stop of the trip.
+// If the train is part of the journey passed to -journey, the destination is
+// where the passenger alights. Cancelled stops are included. Selected stops
+// missing from the trip, e.g. because they were dropped from the route, are
+// skipped; an error is returned only if none of them is found.
+func findDestinations(trip *bahn.Trip) ([]*bahn.Stop, error) {
+	if len(trip.Stops) == 0 {
+		return nil, errors.New("trip contains no stops")
 	}
 
-	destinationStop := finalStop
-	if *destination != "" {
-		var ok bool
-		destinationStop, ok = trip.FindStop(*destination)
+	names := destinationNames(trip)
+	if len(names) == 0 {
+		return []*bahn.Stop{trip.Stops[len(trip.Stops)-1]}, nil
+	}
 
-		if !ok {
-			var stops []string
-			for _, stop := range trip.Stops {
-				stops = append(stops, stop.Station.Name)
+	var (
+		stops    []*bahn.Stop
+		firstErr error
+	)
+	for _, name := range names {
+		stop, err := findStop(trip, name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
 			}
+			continue
+		}
+		stops = append(stops, stop)
+	}
+	if len(stops) == 0 {
+		return nil, firstErr
+	}
+
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stopIndex(trip, stops[i].Station.ID) < stopIndex(trip, stops[j].Station.ID)
+	})
+	return stops, nil
+}
+
+// findDestination returns the first stop selected with -destination that the
+// train has not passed yet and that is not cancelled. Otherwise, the last
+// selected stop is returned. If none was selected, the final stop of the trip
+// is returned.
+func findDestination(trip *bahn.Trip) (*bahn.Stop, error) {
+	stops, err := findDestinations(trip)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stop := range stops {
+		if !stop.Passed && stop.Status != bahn.StopCancelled {
+			return stop, nil
+		}
+	}
+	return stops[len(stops)-1], nil
+}
 
-			return fmt.Errorf("stop %q not found. Valid stops are: %s",
-				*destination, strings.Join(stops, ", "))
+// validateDestinations checks the stops selected with -destination or
+// -journey against trip, the first trip received: all must be found and none
+// may be cancelled. Later on, cancelled stops are reported but don't stop the
+// other destinations from being watched.
+func validateDestinations(trip *bahn.Trip) error {
+	for _, name := range destinationNames(trip) {
+		stop, err := findStop(trip, name)
+		if err != nil {
+			return err
 		}
+		if stop.Status == bahn.StopCancelled {
+			return fmt.Errorf("the stop at %s is cancelled", stop.Station)
+		}
+	}
+	return nil
+}
+
+// finalDestination returns the last stop selected with -destination or, if
+// none was selected, the final stop of the trip.
+func finalDestination(trip *bahn.Trip) (*bahn.Stop, error) {
+	stops, err := findDestinations(trip)
+	if err != nil {
+		return nil, err
+	}
+	return stops[len(stops)-1], nil
+}
+
+// findStop returns the stop of trip matching name. If no stop matches and
+// there is no similarly named stop to suggest, the error lists all stops.
+func findStop(trip *bahn.Trip, name string) (*bahn.Stop, error) {
+	stop, err := trip.LookupStop(name)
+	if notFound, ok := err.(*bahn.StopNotFoundError); ok && len(notFound.Suggestions) == 0 {
+		var stops []string
+		for _, stop := range trip.Stops {
+			stops = append(stops, stop.Station.Name)
+		}
+
+		return nil, fmt.Errorf("stop %q not found. Valid stops are: %s",
+			name, strings.Join(stops, ", "))
 	}
 
-	if destinationStop.Passed {
+	return stop, err
+}
+
+// printTrip prints distance, ETA and delay of the destination and next stop.
+// prefix is printed at the beginning of the line, e.g. to mark stale data.
+// ETAs are relative to now, the time of the update. distanceTo returns the
+// remaining distance to a stop.
+func printTrip(trip *bahn.Trip, now time.Time, prefix string, distanceTo func(*bahn.Stop) float64) error {
+	destinationStop, err := findDestination(trip)
+	if err != nil {
+		return err
+	}
+
+	finalStop := trip.Stops[len(trip.Stops)-1]
+	nextStop := trip.NextStop
+	if nextStop == nil {
+		return fmt.Errorf("train arrived in %v", finalStop)
+	}
+
+	// If the destination is cancelled, the next stop is reported instead.
+	var cancelled *bahn.Stop
+	if destinationStop.Status == bahn.StopCancelled {
+		cancelled, destinationStop = destinationStop, nextStop
+	} else if destinationStop.Passed {
 		return fmt.Errorf("train has passed %v", destinationStop)
 	}
 
 	if destinationStop != nextStop {
-		fmt.Printf("%s%s to %q (via %q): "+
+		fmt.Printf("%s%s%s to %q (via %q): "+
 			"distance=%.0f(%.0f) km, "+
 			"eta=%s(%s), "+
 			"delay=%s(%s)",
-			trip.TrainType, trip.TrainID, destinationStop.Station, nextStop.Station,
-			trip.DistanceTo(destinationStop), trip.DistanceTo(nextStop),
-			formatDuration(destinationStop.ETA()), formatDuration(nextStop.ETA()),
-			formatDuration(destinationStop.Delay()), formatDuration(nextStop.Delay()))
+			prefix, trip.TrainType, trip.TrainID, destinationStop.Station, nextStop.Station,
+			distanceTo(destinationStop), distanceTo(nextStop),
+			formatDuration(etaAt(destinationStop, now)), formatDuration(etaAt(nextStop, now)),
+			formatStopDelay(destinationStop), formatStopDelay(nextStop))
 	} else {
-		fmt.Printf("%s%s to %q: "+
+		fmt.Printf("%s%s%s to %q: "+
 			"distance=%.0f km, "+
 			"eta=%s, "+
 			"delay=%s",
-			trip.TrainType, trip.TrainID, destinationStop.Station,
-			trip.DistanceTo(destinationStop),
-			formatDuration(destinationStop.ETA()),
-			formatDuration(destinationStop.Delay()))
+			prefix, trip.TrainType, trip.TrainID, destinationStop.Station,
+			distanceTo(destinationStop),
+			formatDuration(etaAt(destinationStop, now)),
+			formatStopDelay(destinationStop))
+	}
+
+	// Our own prediction, with the range of plausible arrival times.
+	if pred, ok := predictor.Predict(trip, destinationStop); ok {
+		fmt.Printf(", est=%s(%s-%s)",
+			formatDuration(pred.ETA), formatDuration(pred.Early), formatDuration(pred.Late))
+	}
+
+	if tr, ok := findTransfer(trip); ok && !tr.Stop.Passed {
+		fmt.Printf(", transfer=%.0fmin(%v)", tr.Buffer().Minutes(), tr.Risk(minTransfer))
+	}
+
+	if cancelled != nil {
+		fmt.Printf(", %q cancelled", cancelled.Station)
 	}
 
 	return nil
 }
 
-var speed speedDistribution
+// etaAt is like stop.ETA(), but relative to now instead of the current time.
+// This matters when replaying recordings.
+func etaAt(stop *bahn.Stop, now time.Time) time.Duration {
+	if stop.Passed {
+		return 0
+	}
+	return stop.ActualArrival.Sub(now)
+}
+
+// formatStopDelay formats the delay at stop, followed by an arrow if the
+// delay is growing or shrinking.
+func formatStopDelay(stop *bahn.Stop) string {
+	s := formatDuration(stop.Delay())
+	if st, ok := delays.Stats(stop); ok && st.Trend != bahn.DelayStable {
+		s += st.Trend.Arrow()
+	}
+	return s
+}
 
-func printSpeed(ctx context.Context) error {
-	s, err := bahn.StatusInfo(ctx)
+var (
+	speed     speedDistribution
+	predictor bahn.ETAPredictor
+	delays    bahn.DelayTracker
+	// routes provides the route geometry set with -route, if any.
+	routes *routeSource
+	// itinerary is the journey set with -journey, if any.
+	itinerary *journey
+)
+
+// printWatched prints one line for each stop selected with -destination that
+// the train has not passed yet. Nothing is printed if at most one stop was
+// selected, because printTrip already covers it.
+func printWatched(trip *bahn.Trip, now time.Time, prefix string, distanceTo func(*bahn.Stop) float64) {
+	if len(destinations) < 2 {
+		return
+	}
+
+	stops, err := findDestinations(trip)
 	if err != nil {
-		return err
+		return
 	}
-	speed.add(s.Speed)
 
+	for _, stop := range stops {
+		if stop.Passed {
+			continue
+		}
+		if stop.Status == bahn.StopCancelled {
+			fmt.Printf("%s  %q: cancelled\n", prefix, stop.Station)
+			continue
+		}
+		fmt.Printf("%s  %q: distance=%.0f km, eta=%s, delay=%s, platform=%s\n",
+			prefix, stop.Station, distanceTo(stop),
+			formatDuration(etaAt(stop, now)), formatStopDelay(stop), stop.Platform)
+	}
+}
+
+func printSpeed(s *bahn.Status) {
 	fmt.Printf(", speed=%.0f/%.0f/%.0f [km/h] (cur/avg/max)",
 		s.Speed, speed.average(), speed.max())
+}
+
+// printUpdate prints the state in s. If the data is stale, the line is
+// prefixed with "~" and the age of the data is printed. Errors encountered
+// while polling, as recorded in u, are returned.
+func printUpdate(u *update, s *snapshot) error {
+	if s.Trip == nil {
+		return u.err()
+	}
+
+	prefix := ""
+	if s.Stale {
+		prefix = "~"
+	}
+	var r *bahn.Route
+	if routes != nil {
+		r = routes.route(s.Trip)
+	}
+	distanceTo := routeDistance(r, s.Trip, s.Position)
+	if err := printTrip(s.Trip, u.Time, prefix, distanceTo); err != nil {
+		fmt.Println()
+		return err
+	}
+
+	if s.Status != nil {
+		printSpeed(s.Status)
+	}
+	if s.Stale {
+		fmt.Printf(", age=%.0fs", s.Age.Seconds())
+	}
+	fmt.Println()
+
+	printWatched(s.Trip, u.Time, prefix, distanceTo)
+
+	return u.err()
+}
 
+// setupDestinations checks the flags registered by destinationFlags and
+// loads the files they refer to.
+func setupDestinations() error {
+	if routePath != "" {
+		routes = newRouteSource(routePath)
+	}
+	if journeyPath != "" {
+		if len(destinations) != 0 {
+			return errors.New("-journey and -destination are mutually exclusive")
+		}
+		var err error
+		if itinerary, err = loadJourney(journeyPath); err != nil {
+			return err
+		}
+	}
+	if connection != "" {
+		if _, err := parseDeparture(connection, time.Now()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func printUpdate(ctx context.Context) error {
-	trip, err := bahn.TripInfo(ctx)
+// newOutputs returns the sinks enabled with the flags registered by
+// outputFlags and serverFlags. The trip summary is not included.
+func newOutputs() (sinks, error) {
+	if proxy && listen == "" {
+		return nil, errors.New("-proxy requires -listen")
+	}
+
+	var outputs sinks
+	if gpxFile != "" {
+		outputs = append(outputs, newFileSink(gpxFile, writeGPX))
+	}
+	if geoJSONFile != "" {
+		outputs = append(outputs, newFileSink(geoJSONFile, writeGeoJSON))
+	}
+	if kmlFile != "" {
+		outputs = append(outputs, newFileSink(kmlFile, writeKML))
+	}
+	if recordDir != "" {
+		rec, err := newRecorder(recordDir)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, rec)
+	}
+	if len(notify) != 0 || alarmBefore > 0 || alarmDistance > 0 {
+		if len(notify) == 0 {
+			notify = stringList{"bell"}
+		}
+		var notifiers []notifier
+		for _, spec := range notify {
+			n, err := newNotifier(spec)
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		outputs = append(outputs, newAlarms(alarmBefore, alarmDistance, alarmDelay, notifiers))
+	}
+	if len(webhookURLs) != 0 {
+		outputs = append(outputs, newWebhook(webhookURLs, webhookSecret, webhookMinDelay))
+	}
+	if mqttURL != "" {
+		client, err := newMQTTClient(mqttURL)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, newMQTTPublisher(client, mqttPrefix))
+	}
+	if listen != "" {
+		srv, err := startServer()
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, srv...)
+	}
+
+	return outputs, nil
+}
+
+// startServer starts the HTTP server configured with serverFlags. It returns
+// the server and, with -proxy, the proxy cache as sinks.
+func startServer() (sinks, error) {
+	var outputs sinks
+	srv := newServer(listen)
+	if proxy {
+		cache := newProxyCache(interval)
+		srv.mux.Handle(bahn.StatusPath, cache)
+		srv.mux.Handle(bahn.TripInfoPath, cache)
+		outputs = append(outputs, cache)
+	}
+	if err := srv.start(); err != nil {
+		return nil, err
+	}
+	return append(outputs, srv), nil
+}
+
+// newPoller returns a poller for the portal configured with portalFlags.
+func newPoller() *poller {
+	retry := bahn.DefaultRetryPolicy
+	retry.MaxAttempts = retries
+	return &poller{
+		client: &bahn.Client{
+			BaseURL: strings.TrimSuffix(portal, "/"),
+			Retry:   &retry,
+		},
+	}
+}
+
+// pipeline processes updates, whether polled from the portal or replayed from
+// a recording: it detects events, keeps the statistics of the trip, prints the
+// state unless quiet is set, and passes the updates to the sinks.
+type pipeline struct {
+	outputs sinks
+	quiet   bool
+
+	detector  eventDetector
+	validated bool
+}
+
+// validate checks the selected destinations against the first trip received,
+// see validateDestinations.
+func (pl *pipeline) validate(u *update) error {
+	if pl.validated || u.Trip == nil {
+		return nil
+	}
+	pl.validated = true
+	return validateDestinations(u.Trip)
+}
+
+// process handles u. s is the best known state at the time of u. Errors
+// encountered while polling, as recorded in u, are returned.
+func (pl *pipeline) process(u *update, s *snapshot) error {
+	if itinerary != nil && itinerary.advance(u.Trip) {
+		log.Printf("changed trains, now on leg %d of %d: %s",
+			itinerary.current+1, len(itinerary.Legs), itinerary.Legs[itinerary.current])
+	}
+	u.Events = pl.detector.detect(u)
+	if u.tripChanged() {
+		// Statistics of the previous trip don't apply to the new one.
+		speed = speedDistribution{}
+		predictor = bahn.ETAPredictor{}
+		delays = bahn.DelayTracker{}
+	}
+	if u.Trip != nil {
+		delays.Update(u.Trip, u.Time)
+	}
+	for _, e := range u.Events {
+		switch e.Kind {
+		case eventTripChanged:
+			log.Println(e.Message)
+		case eventStopCancelled:
+			log.Printf("warning: %s", e.Message)
+		}
+	}
+	if u.Status != nil {
+		speed.add(u.Status.Speed)
+		predictor.AddSpeed(u.Time, u.Status.Speed)
+	}
+
+	err := u.err()
+	if !pl.quiet {
+		err = printUpdate(u, s)
+	}
 	if err != nil {
-		return err
+		log.Println(err)
 	}
+	pl.outputs.update(u)
 
-	defer fmt.Println()
+	return err
+}
 
-	if err := printTrip(trip); err != nil {
-		return err
+// pollLoop polls the portal every -interval, -count times, and passes the
+// updates to pl. While the portal is unreachable, the interval grows up to
+// -max-backoff. dump is called when the user requests the statistics so far;
+// it may be nil. An error is returned if the selected destinations are
+// invalid.
+func pollLoop(ctx context.Context, p *poller, pl *pipeline, dump func()) error {
+	// During outages, the poll interval grows exponentially up to -max-backoff.
+	outageBackoff := bahn.RetryPolicy{
+		InitialBackoff: interval,
+		MaxBackoff:     maxBackoff,
+		Multiplier:     2,
+		Jitter:         0.1,
 	}
+	if outageBackoff.MaxBackoff < interval {
+		outageBackoff.MaxBackoff = interval
+	}
+	var failures int
 
-	if err := printSpeed(ctx); err != nil {
-		return err
+	dumpCh := dumpChannel()
+	if dump == nil {
+		dump = func() {}
+	}
+
+	for count != 0 {
+		if count > 0 {
+			count--
+		}
+
+		pollCtx, pollCancel := context.WithTimeout(ctx, interval)
+		u := p.poll(pollCtx)
+		pollCancel()
+		if ctx.Err() != nil {
+			// Interrupted mid-request: the partial update is not useful.
+			return nil
+		}
+		if err := pl.validate(u); err != nil {
+			return err
+		}
+
+		err := pl.process(u, p.snapshot(u.Time))
+		if count == 0 && err == nil {
+			break
+		}
+
+		wait := interval
+		if u.Trip == nil && u.Status == nil {
+			wait = outageBackoff.Backoff(failures)
+			failures++
+		} else if failures != 0 {
+			log.Printf("portal reachable again after %d failed polls", failures)
+			failures = 0
+		}
+
+		if err := sleep(ctx, wait, dumpCh, dump); err != nil {
+			return nil
+		}
 	}
 
 	return nil
 }
 
-func main() {
-	flag.Parse()
-	ctx := context.Background()
+// runWatch implements the "watch" command, icestat's default: it reports the
+// train's progress every -interval and prints a summary of the trip on exit.
+func runWatch(fs *flag.FlagSet) int {
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := setupDestinations(); err != nil {
+		log.Println(err)
+		return 2
+	}
 
-	for *count != 0 {
-		if *count > 0 {
-			*count -= 1
-		}
+	stats := newSummary(summaryMarkdown, summaryJSON)
+	outputs, err := newOutputs()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	outputs = append(sinks{stats}, outputs...)
+	defer outputs.close()
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
 
-		ctx, cancel := context.WithTimeout(ctx, *interval)
-		if err := printUpdate(ctx); err != nil {
-			cancel()
+	err = pollLoop(ctx, newPoller(), &pipeline{outputs: outputs}, func() {
+		if err := stats.dump(os.Stderr); err != nil {
 			log.Println(err)
-			time.Sleep(*interval)
-			continue
 		}
-		cancel()
+	})
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	return 0
+}
 
-		if *count != 0 {
-			time.Sleep(*interval)
-		}
+// runServe implements the "serve" command: it polls the portal and serves the
+// train's state via HTTP without printing it.
+func runServe(fs *flag.FlagSet) int {
+	if fs.NArg() != 0 || listen == "" {
+		fs.Usage()
+		return 2
+	}
+	if err := setupDestinations(); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	outputs, err := startServer()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer outputs.close()
+	log.Printf("serving on http://%s/", listen)
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
+
+	if err := pollLoop(ctx, newPoller(), &pipeline{outputs: outputs, quiet: true}, nil); err != nil {
+		log.Println(err)
+		return 2
+	}
+	return 0
+}
+
+// runRecord implements the "record" command: it polls the portal and records
+// its responses to a directory, for "icestat stats", "replay" and "export".
+func runRecord(fs *flag.FlagSet) int {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	rec, err := newRecorder(fs.Arg(0))
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	outputs := sinks{rec}
+	defer outputs.close()
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
+
+	if err := pollLoop(ctx, newPoller(), &pipeline{outputs: outputs, quiet: true}, nil); err != nil {
+		log.Println(err)
+		return 2
+	}
+	return 0
+}
+
+// runStatus implements the "status" command: it polls the portal once and
+// prints the train's state.
+func runStatus(fs *flag.FlagSet) int {
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := setupDestinations(); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
+
+	p := newPoller()
+	u := p.poll(ctx)
+	pl := &pipeline{}
+	if err := pl.validate(u); err != nil {
+		log.Println(err)
+		return 2
+	}
+	if err := pl.process(u, p.snapshot(u.Time)); err != nil {
+		return 1
 	}
+	return 0
 }
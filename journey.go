@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// journeyLeg is a part of a journey traveled on a single train.
+type journeyLeg struct {
+	// Train is the train's type and number, e.g. "ICE 521", or just the
+	// number.
+	Train string `json:"train"`
+	// From and To are the stations where the passenger boards and alights,
+	// as accepted by bahn.Trip.LookupStop.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (l journeyLeg) String() string {
+	if l.From == "" {
+		return fmt.Sprintf("%s to %s", l.Train, l.To)
+	}
+	return fmt.Sprintf("%s from %s to %s", l.Train, l.From, l.To)
+}
+
+// journey is a trip across several trains, as read from the file passed to
+// -journey:
+//
+//	{"legs": [
+//	  {"train": "ICE 521", "from": "Köln Hbf", "to": "Nürnberg Hbf"},
+//	  {"train": "RE 4010", "from": "Nürnberg Hbf", "to": "Regensburg Hbf"}
+//	]}
+type journey struct {
+	Legs []journeyLeg `json:"legs"`
+
+	// current is the index of the leg the passenger is on.
+	current int
+}
+
+func loadJourney(path string) (*journey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var j journey
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if len(j.Legs) == 0 {
+		return nil, fmt.Errorf("%s: journey has no legs", path)
+	}
+	for i, l := range j.Legs {
+		if l.Train == "" || l.To == "" {
+			return nil, fmt.Errorf("%s: leg %d: train and destination are required", path, i+1)
+		}
+	}
+
+	return &j, nil
+}
+
+// leg returns the leg traveled on trip's train, or nil if the train is not
+// part of the journey. If the journey uses the same train several times, the
+// current leg is preferred.
+func (j *journey) leg(trip *bahn.Trip) *journeyLeg {
+	if l := &j.Legs[j.current]; l.matches(trip) {
+		return l
+	}
+	for i := range j.Legs {
+		if l := &j.Legs[i]; l.matches(trip) {
+			return l
+		}
+	}
+	return nil
+}
+
+// advance checks whether the passenger changed to the train of a later leg
+// and, if so, makes it the current leg. It returns true if the leg changed.
+func (j *journey) advance(trip *bahn.Trip) bool {
+	if trip == nil {
+		return false
+	}
+
+	for i := j.current + 1; i < len(j.Legs); i++ {
+		if j.Legs[i].matches(trip) {
+			j.current = i
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if trip is the train of leg l.
+func (l *journeyLeg) matches(trip *bahn.Trip) bool {
+	normalize := func(s string) string {
+		return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	}
+
+	train := normalize(l.Train)
+	return train == normalize(trip.TrainType+trip.TrainID) || train == normalize(trip.TrainID)
+}
+
+// findBoarding returns the stop where the passenger boarded trip's train,
+// according to -journey, or nil if unknown.
+func findBoarding(trip *bahn.Trip) *bahn.Stop {
+	if itinerary == nil {
+		return nil
+	}
+	l := itinerary.leg(trip)
+	if l == nil || l.From == "" {
+		return nil
+	}
+
+	stop, err := trip.LookupStop(l.From)
+	if err != nil {
+		return nil
+	}
+	return stop
+}
+
+// sameTrain returns true if a and b are trips of the same train on the same
+// day.
+func sameTrain(a, b *bahn.Trip) bool {
+	return a.TrainType == b.TrainType && a.TrainID == b.TrainID && a.Date.Equal(b.Date)
+}
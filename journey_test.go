@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+func TestLoadJourney(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icestat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name string
+		data string
+		err  string // expected error substring, empty if valid
+	}{
+		{"valid", `{"legs": [{"train": "ICE 521", "from": "Köln Hbf", "to": "Nürnberg Hbf"}, {"train": "RE 4010", "to": "Regensburg Hbf"}]}`, ""},
+		{"syntax", `{"legs": [`, "unexpected end of JSON input"},
+		{"empty", `{"legs": []}`, "journey has no legs"},
+		{"no train", `{"legs": [{"train": "ICE 521", "to": "Nürnberg Hbf"}, {"to": "Regensburg Hbf"}]}`, "leg 2: train and destination are required"},
+		{"no destination", `{"legs": [{"train": "ICE 521", "from": "Köln Hbf"}]}`, "leg 1: train and destination are required"},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, strings.Replace(c.name, " ", "_", -1)+".json")
+		if err := ioutil.WriteFile(path, []byte(c.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		j, err := loadJourney(path)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: loadJourney() = %v", c.name, err)
+			} else if len(j.Legs) != 2 || j.Legs[1].Train != "RE 4010" || j.Legs[0].From != "Köln Hbf" {
+				t.Errorf("%s: loadJourney() = %+v", c.name, j.Legs)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) || !strings.HasPrefix(err.Error(), path+": ") {
+			t.Errorf("%s: loadJourney() = %v, want error %q prefixed with the path", c.name, err, c.err)
+		}
+	}
+
+	if _, err := loadJourney(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("loadJourney() of a missing file succeeded")
+	}
+}
+
+func TestJourneyLegMatches(t *testing.T) {
+	trip := &bahn.Trip{TrainType: "ICE", TrainID: "521"}
+
+	cases := []struct {
+		train string
+		want  bool
+	}{
+		{"ICE 521", true},
+		{"ICE521", true},
+		{"521", true},
+		{"ice  521", true},
+		{"ICE 523", false},
+		{"IC 521", false},
+		{"52", false},
+	}
+
+	for _, c := range cases {
+		l := journeyLeg{Train: c.train, To: "Nürnberg Hbf"}
+		if got := l.matches(trip); got != c.want {
+			t.Errorf("journeyLeg{Train: %q}.matches(ICE 521) = %v, want %v", c.train, got, c.want)
+		}
+	}
+}
+
+func TestJourneyAdvance(t *testing.T) {
+	j := &journey{Legs: []journeyLeg{
+		{Train: "ICE 521", To: "Nürnberg Hbf"},
+		{Train: "RE 4010", To: "Regensburg Hbf"},
+		{Train: "ICE 28", To: "Passau Hbf"},
+	}}
+	train := func(typ, id string) *bahn.Trip {
+		return &bahn.Trip{TrainType: typ, TrainID: id}
+	}
+
+	cases := []struct {
+		trip    *bahn.Trip
+		want    bool
+		current int
+	}{
+		{nil, false, 0},
+		{train("ICE", "521"), false, 0},
+		{train("RE", "4010"), true, 1},
+		// Seeing an earlier train again doesn't go back.
+		{train("ICE", "521"), false, 1},
+		{train("IC", "2023"), false, 1},
+		{train("ICE", "28"), true, 2},
+		{train("RE", "4010"), false, 2},
+	}
+
+	for i, c := range cases {
+		if got := j.advance(c.trip); got != c.want || j.current != c.current {
+			t.Errorf("step %d: advance() = %v, current leg %d, want %v, %d", i, got, j.current, c.want, c.current)
+		}
+	}
+}
+
+func TestFindBoarding(t *testing.T) {
+	defer func(saved *journey) { itinerary = saved }(itinerary)
+
+	trip := summaryTrip("ICE 521",
+		summaryStop{"Köln Hbf", "20:00", 2 * time.Minute, 0, true},
+		summaryStop{"Siegburg/Bonn", "20:20", 3 * time.Minute, 25, true},
+		summaryStop{"Frankfurt (M) Flughafen Fernbf", "21:00", 7 * time.Minute, 145, false})
+	route := func() []string {
+		s := newSummary("", "")
+		s.update(&update{Time: at("20:30"), Trip: trip})
+		return s.report().Route
+	}
+
+	itinerary = nil
+	if stop := findBoarding(trip); stop != nil {
+		t.Errorf("findBoarding() without -journey = %v, want nil", stop)
+	}
+	if got, want := route(), []string{"Köln Hbf", "Siegburg/Bonn", "Frankfurt (M) Flughafen Fernbf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("route without -journey = %q, want %q", got, want)
+	}
+
+	itinerary = &journey{Legs: []journeyLeg{
+		{Train: "ICE 521", From: "Siegburg", To: "Frankfurt Flughafen"},
+	}}
+	if stop := findBoarding(trip); stop == nil || stop.Station.Name != "Siegburg/Bonn" {
+		t.Errorf("findBoarding() = %v, want Siegburg/Bonn", stop)
+	}
+	// The summary starts where the passenger boarded.
+	if got, want := route(), []string{"Siegburg/Bonn", "Frankfurt (M) Flughafen Fernbf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("route = %q, want %q", got, want)
+	}
+
+	// Other trains and unknown stations are ignored.
+	itinerary.Legs[0].Train = "ICE 523"
+	if stop := findBoarding(trip); stop != nil {
+		t.Errorf("findBoarding() for another train = %v, want nil", stop)
+	}
+	itinerary.Legs[0] = journeyLeg{Train: "ICE 521", From: "Hamburg", To: "Frankfurt Flughafen"}
+	if stop := findBoarding(trip); stop != nil {
+		t.Errorf("findBoarding() for an unknown station = %v, want nil", stop)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/octo/icestat/bahn"
+)
+
+type kmlDocument struct {
+	XMLName  xml.Name   `xml:"kml"`
+	Xmlns    string     `xml:"xmlns,attr"`
+	Document kmlContent `xml:"Document"`
+}
+
+type kmlContent struct {
+	Name       string         `xml:"name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	TimeStamp   *kmlTimeStamp  `xml:"TimeStamp,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlCoordinates formats a position in KML's longitude,latitude order.
+func kmlCoordinates(lat, lon float64) string {
+	return fmt.Sprintf("%g,%g", lon, lat)
+}
+
+// writeKML writes trip and tr as a KML document to w, using the same
+// features as writeGeoJSON. trip may be nil.
+func writeKML(w io.Writer, trip *bahn.Trip, tr *track) error {
+	doc := kmlDocument{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+	}
+
+	name := "icestat"
+	if trip != nil {
+		name = tripName(trip)
+	}
+	doc.Document.Name = name
+
+	for _, points := range tr.segments() {
+		if len(points) < 2 {
+			continue
+		}
+		var coords []string
+		for _, p := range points {
+			coords = append(coords, kmlCoordinates(p.Latitude, p.Longitude))
+		}
+
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name: name + " track",
+			LineString: &kmlLineString{
+				Tessellate:  1,
+				Coordinates: strings.Join(coords, " "),
+			},
+		})
+	}
+
+	if trip != nil {
+		for _, stop := range trip.Stops {
+			pm := kmlPlacemark{
+				Name: stop.Station.Name,
+				Description: fmt.Sprintf("Platform %s, delay %s, %.0f km from start",
+					stop.Platform, formatDelay(stop.Delay()), stop.DistanceFromStart),
+				Point: &kmlPoint{
+					Coordinates: kmlCoordinates(stop.Station.Latitude, stop.Station.Longitude),
+				},
+			}
+			if t := gpxTime(stop.ActualArrival); t != "" {
+				pm.TimeStamp = &kmlTimeStamp{When: t}
+			}
+
+			doc.Document.Placemarks = append(doc.Document.Placemarks, pm)
+		}
+	}
+
+	if n := len(tr.points); n != 0 {
+		p := tr.points[n-1]
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:        name,
+			Description: fmt.Sprintf("%.0f km/h", p.Speed),
+			TimeStamp:   &kmlTimeStamp{When: gpxTime(p.ServerTime)},
+			Point: &kmlPoint{
+				Coordinates: kmlCoordinates(p.Latitude, p.Longitude),
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+func TestMQTTPacketLength(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 321, 16383, 16384, 2097151, 2097152} {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := writeMQTTPacket(w, mqttPublish, make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+
+		typ, body, err := readMQTTPacket(bufio.NewReader(&buf))
+		if err != nil {
+			t.Errorf("readMQTTPacket(<%d bytes>) = %v", n, err)
+			continue
+		}
+		if typ != mqttPublish || len(body) != n {
+			t.Errorf("readMQTTPacket() = (%#x, <%d bytes>), want (%#x, <%d bytes>)", typ, len(body), mqttPublish, n)
+		}
+	}
+
+	// The remaining length is encoded least significant group first.
+	var buf bytes.Buffer
+	writeMQTTPacket(bufio.NewWriter(&buf), mqttPublish, make([]byte, 321))
+	if got, want := buf.Bytes()[:3], []byte{mqttPublish, 0xC1, 0x02}; !bytes.Equal(got, want) {
+		t.Errorf("header = %#v, want %#v", got, want)
+	}
+}
+
+type mqttPacket struct {
+	typ  byte
+	body []byte
+}
+
+// fakeBroker is a minimal MQTT broker accepting a single connection. It
+// acknowledges CONNECT and records all packets it receives.
+type fakeBroker struct {
+	ln      net.Listener
+	packets chan mqttPacket
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &fakeBroker{
+		ln:      ln,
+		packets: make(chan mqttPacket, 100),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	defer close(b.packets)
+
+	conn, err := b.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		typ, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		b.packets <- mqttPacket{typ, body}
+
+		if typ&0xF0 == mqttConnect {
+			writeMQTTPacket(w, mqttConnAck, []byte{0, 0})
+		}
+	}
+}
+
+// next returns the next packet received by the broker.
+func (b *fakeBroker) next(t *testing.T) mqttPacket {
+	select {
+	case p, ok := <-b.packets:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+	return mqttPacket{}
+}
+
+// readString consumes a length prefixed string from *b.
+func readString(t *testing.T, b *[]byte) string {
+	if len(*b) < 2 {
+		t.Fatalf("short packet: %q", *b)
+	}
+	n := int((*b)[0])<<8 | int((*b)[1])
+	if len(*b) < 2+n {
+		t.Fatalf("short packet: %q", *b)
+	}
+	s := string((*b)[2 : 2+n])
+	*b = (*b)[2+n:]
+	return s
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	b := newFakeBroker(t)
+	defer b.ln.Close()
+
+	client, err := newMQTTClient("tcp://user:secret@" + b.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newMQTTPublisher(client, "icestat/")
+
+	trip := &bahn.Trip{
+		TrainType: "ICE",
+		TrainID:   "521",
+		Stops: []*bahn.Stop{
+			{Station: &bahn.Station{ID: "8000261_00", Name: "München Hbf"}},
+		},
+	}
+	p.update(&update{
+		Time:   time.Now(),
+		Trip:   trip,
+		Status: &bahn.Status{Speed: 247},
+		Events: []event{{Kind: eventDeparted, Train: "ICE 521"}},
+	})
+	p.close()
+
+	connect := b.next(t)
+	if connect.typ != mqttConnect {
+		t.Fatalf("first packet has type %#x, want CONNECT", connect.typ)
+	}
+	body := connect.body
+	if got := readString(t, &body); got != "MQTT" {
+		t.Errorf("protocol name = %q, want %q", got, "MQTT")
+	}
+	if got, want := body[:4], []byte{4, 0xE6, 0, 60}; !bytes.Equal(got, want) {
+		t.Errorf("level, flags, keep alive = %#v, want %#v", got, want)
+	}
+	body = body[4:]
+	readString(t, &body) // client ID
+	for _, want := range []string{"icestat/availability", "offline", "user", "secret"} {
+		if got := readString(t, &body); got != want {
+			t.Errorf("CONNECT payload contains %q, want %q", got, want)
+		}
+	}
+
+	cases := []struct {
+		topic   string
+		payload string
+		retain  bool
+	}{
+		{"icestat/availability", "online", true},
+		{"icestat/ICE521/speed", "247", true},
+		{"icestat/ICE521/status", "", true},
+		{"icestat/ICE521/stops/8000261", "", true},
+		{"icestat/ICE521/events", "", false},
+		{"icestat/availability", "offline", true},
+	}
+	for _, c := range cases {
+		pkt := b.next(t)
+		if pkt.typ&0xF0 != mqttPublish {
+			t.Fatalf("got packet type %#x, want PUBLISH to %s", pkt.typ, c.topic)
+		}
+		body := pkt.body
+		if got := readString(t, &body); got != c.topic {
+			t.Errorf("PUBLISH to %q, want %q", got, c.topic)
+			continue
+		}
+		if c.payload != "" && string(body) != c.payload {
+			t.Errorf("PUBLISH %q to %s, want %q", body, c.topic, c.payload)
+		}
+		if retain := pkt.typ&0x01 != 0; retain != c.retain {
+			t.Errorf("PUBLISH to %s: retain = %v, want %v", c.topic, retain, c.retain)
+		}
+	}
+
+	if pkt := b.next(t); pkt.typ != mqttDisconnect {
+		t.Errorf("got packet type %#x, want DISCONNECT", pkt.typ)
+	}
+}
+
+func TestMQTTReconnectBackoff(t *testing.T) {
+	// A port nobody listens on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client, err := newMQTTClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.publish("topic", nil, false); err == nil || err == errMQTTBackoff {
+		t.Fatalf("publish() = %v, want connection error", err)
+	}
+	// The next attempt to connect is delayed.
+	if err := client.publish("topic", nil, false); err != errMQTTBackoff {
+		t.Errorf("publish() = %v, want %v", err, errMQTTBackoff)
+	}
+}
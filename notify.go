@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// notifier delivers alarms to the user.
+type notifier interface {
+	notify(a *alarm) error
+}
+
+// newNotifier returns the notifier described by spec, as passed to -notify:
+// "bell", "exec:<command>" or "fifo:<path>".
+func newNotifier(spec string) (notifier, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i != -1 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch {
+	case kind == "bell" && arg == "":
+		return bellNotifier{}, nil
+	case kind == "exec" && arg != "":
+		return execNotifier{command: arg}, nil
+	case kind == "fifo" && arg != "":
+		return fifoNotifier{path: arg}, nil
+	}
+
+	return nil, fmt.Errorf("invalid notifier %q, want \"bell\", \"exec:<command>\" or \"fifo:<path>\"", spec)
+}
+
+// bellNotifier rings the terminal bell and logs the alarm's message.
+type bellNotifier struct{}
+
+func (bellNotifier) notify(a *alarm) error {
+	log.Printf("\a%s", a.Message)
+	return nil
+}
+
+// execNotifier runs a shell command for every alarm. The details of the alarm
+// are passed in environment variables prefixed with "ICESTAT_".
+type execNotifier struct {
+	command string
+}
+
+func (n execNotifier) notify(a *alarm) error {
+	cmd := shellCommand(n.command)
+	cmd.Env = append(os.Environ(), alarmEnv(a)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v", n.command, err)
+	}
+	return nil
+}
+
+// alarmEnv returns the environment variables describing a.
+func alarmEnv(a *alarm) []string {
+	return []string{
+		"ICESTAT_KIND=" + a.Kind,
+		"ICESTAT_TIME=" + a.Time.Format("2006-01-02T15:04:05Z07:00"),
+		"ICESTAT_TRAIN=" + a.Train,
+		"ICESTAT_STATION=" + a.Station,
+		"ICESTAT_EVA_NR=" + a.EvaNr,
+		"ICESTAT_MESSAGE=" + a.Message,
+		"ICESTAT_OLD=" + a.Old,
+		"ICESTAT_NEW=" + a.New,
+		"ICESTAT_PLATFORM=" + a.Platform,
+		fmt.Sprintf("ICESTAT_DISTANCE_KM=%.1f", a.Distance),
+		fmt.Sprintf("ICESTAT_ETA_MINUTES=%.0f", a.ETAMinutes),
+		fmt.Sprintf("ICESTAT_DELAY_MINUTES=%.0f", a.DelayMinutes),
+	}
+}
+
+// fifoNotifier writes every alarm as a line of JSON to a named pipe. Alarms
+// are dropped while no process is reading from the pipe.
+type fifoNotifier struct {
+	path string
+}
+
+func (n fifoNotifier) notify(a *alarm) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(n.path, fifoFlags, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// fifoFlags are the flags for opening a FIFO. This platform has no FIFOs in
+// the file system, so alarms are appended to a regular file or named pipe.
+const fifoFlags = os.O_WRONLY | os.O_APPEND
+
+// shellCommand returns a command running command with the system's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "plan9" {
+		return exec.Command("/bin/rc", "-c", command)
+	}
+	return exec.Command("cmd", "/C", command)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewNotifier(t *testing.T) {
+	cases := []struct {
+		spec string
+		want notifier // nil if spec is invalid
+	}{
+		{"bell", bellNotifier{}},
+		{"exec:notify-send icestat", execNotifier{command: "notify-send icestat"}},
+		{"exec:curl -d @- http://localhost:8080/", execNotifier{command: "curl -d @- http://localhost:8080/"}},
+		{"fifo:/run/icestat.fifo", fifoNotifier{path: "/run/icestat.fifo"}},
+		{"", nil},
+		{"bell:loud", nil},
+		{"exec", nil},
+		{"exec:", nil},
+		{"fifo:", nil},
+		{"mail:me@example.com", nil},
+	}
+
+	for _, c := range cases {
+		got, err := newNotifier(c.spec)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("newNotifier(%q) = %#v, want error", c.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("newNotifier(%q) = (%#v, %v), want %#v", c.spec, got, err, c.want)
+		}
+	}
+}
+
+// testAlarm is an alarm about arriving at Frankfurt Airport.
+var testAlarm = &alarm{
+	event: event{
+		ID:      3,
+		Time:    time.Date(2018, 8, 2, 20, 51, 0, 0, time.UTC),
+		Kind:    eventApproaching,
+		Train:   "ICE 521",
+		EvaNr:   "8070003_00",
+		Station: "Frankfurt (M) Flughafen Fernbf",
+		Message: "arriving at Frankfurt (M) Flughafen Fernbf on platform 5 in 0:09 (15.0 km)",
+	},
+	Distance:     15.04,
+	ETAMinutes:   9,
+	DelayMinutes: 2.4,
+	Platform:     "5",
+}
+
+func TestAlarmEnv(t *testing.T) {
+	want := []string{
+		"ICESTAT_KIND=approaching",
+		"ICESTAT_TIME=2018-08-02T20:51:00Z",
+		"ICESTAT_TRAIN=ICE 521",
+		"ICESTAT_STATION=Frankfurt (M) Flughafen Fernbf",
+		"ICESTAT_EVA_NR=8070003_00",
+		"ICESTAT_MESSAGE=arriving at Frankfurt (M) Flughafen Fernbf on platform 5 in 0:09 (15.0 km)",
+		"ICESTAT_OLD=",
+		"ICESTAT_NEW=",
+		"ICESTAT_PLATFORM=5",
+		"ICESTAT_DISTANCE_KM=15.0",
+		"ICESTAT_ETA_MINUTES=9",
+		"ICESTAT_DELAY_MINUTES=2",
+	}
+
+	if got := alarmEnv(testAlarm); !reflect.DeepEqual(got, want) {
+		t.Errorf("alarmEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestFIFONotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icestat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A regular file stands in for the FIFO, which is not created.
+	n := fifoNotifier{path: filepath.Join(dir, "alarms")}
+	if err := n.notify(testAlarm); err == nil {
+		t.Errorf("notify() succeeded without %s", n.path)
+	}
+
+	if err := ioutil.WriteFile(n.path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := n.notify(testAlarm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(n.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for i := 0; i < 2; i++ {
+		var got struct {
+			Kind       string  `json:"kind"`
+			EvaNr      string  `json:"eva_nr"`
+			ETAMinutes float64 `json:"eta_minutes"`
+		}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("line %d of %q: %v", i+1, data, err)
+		}
+		if got.Kind != eventApproaching || got.EvaNr != "8070003_00" || got.ETAMinutes != 9 {
+			t.Errorf("line %d = %+v, want the approaching alarm", i+1, got)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// fifoFlags are the flags for opening a FIFO. Opening it non-blocking fails
+// instead of waiting while there is no reader.
+const fifoFlags = os.O_WRONLY | os.O_APPEND | syscall.O_NONBLOCK
+
+// shellCommand returns a command running command with the user's shell.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// poller queries the portal and keeps the last successfully retrieved trip
+// and status, so that output can continue when the portal is unreachable.
+type poller struct {
+	client    *bahn.Client
+	estimator bahn.Estimator
+
+	trip       *bahn.Trip
+	tripTime   time.Time
+	status     *bahn.Status
+	statusTime time.Time
+}
+
+// snapshot is the best known state at a point in time. If the data is stale,
+// i.e. the last poll failed, the train's position is extrapolated.
+type snapshot struct {
+	Trip   *bahn.Trip
+	Status *bahn.Status
+	// Age is the age of the oldest piece of information in the snapshot.
+	Age   time.Duration
+	Stale bool
+
+	// Position is the estimated position of the train. It is the zero value
+	// if unknown.
+	Position bahn.Position
+}
+
+// poll queries the portal for trip and status information.
+func (p *poller) poll(ctx context.Context) *update {
+	u := &update{
+		Time: time.Now(),
+	}
+
+	if u.RawTrip, u.TripErr = p.client.Get(ctx, bahn.TripInfoPath); u.TripErr == nil {
+		var trip bahn.Trip
+		if u.TripErr = json.Unmarshal(u.RawTrip, &trip); u.TripErr == nil {
+			u.Trip = &trip
+		}
+	}
+
+	if u.RawStatus, u.StatusErr = p.client.Get(ctx, bahn.StatusPath); u.StatusErr == nil {
+		var status bahn.Status
+		if u.StatusErr = json.Unmarshal(u.RawStatus, &status); u.StatusErr == nil {
+			u.Status = &status
+		}
+	}
+
+	p.add(u)
+	return u
+}
+
+// add remembers the trip and status of u. It is called by poll and, when
+// replaying a recording, for each recorded update.
+func (p *poller) add(u *update) {
+	if u.Trip != nil {
+		p.trip, p.tripTime = u.Trip, u.Time
+		p.estimator.UpdateTrip(u.Trip, u.Time)
+	}
+	if u.Status != nil {
+		p.status, p.statusTime = u.Status, u.Time
+		p.estimator.UpdateStatus(u.Status, u.Time)
+	}
+}
+
+// snapshot returns the last known trip and status at time t. If the trip is
+// older than t, its position is extrapolated using the last known speed.
+func (p *poller) snapshot(t time.Time) *snapshot {
+	s := &snapshot{
+		Trip:   p.trip,
+		Status: p.status,
+	}
+
+	if p.trip != nil {
+		s.Age = t.Sub(p.tripTime)
+	}
+	if p.status != nil {
+		if age := t.Sub(p.statusTime); age > s.Age {
+			s.Age = age
+		}
+	}
+	s.Stale = s.Age > 0
+
+	if s.Trip != nil {
+		s.Trip = p.estimator.Trip(t)
+	}
+	if pos, ok := p.estimator.Position(t); ok {
+		s.Position = pos
+	}
+
+	return s
+}
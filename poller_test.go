@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// pollerTrip returns a trip between Köln Hbf and Siegburg/Bonn, 25 km apart,
+// with the train the given distance past Köln Hbf.
+func pollerTrip(distance float64) *bahn.Trip {
+	koeln := &bahn.Stop{
+		Station: &bahn.Station{ID: "8000207_00", Name: "Köln Hbf", Latitude: 50.943, Longitude: 6.959},
+		Passed:  true,
+	}
+	siegburg := &bahn.Stop{
+		Station:           &bahn.Station{ID: "8005556_00", Name: "Siegburg/Bonn", Latitude: 50.794, Longitude: 7.203},
+		DistanceFromStart: 25,
+	}
+	return &bahn.Trip{
+		TrainType:            "ICE",
+		TrainID:              "521",
+		DistanceFromLastStop: distance,
+		PreviousStop:         koeln,
+		NextStop:             siegburg,
+		Stops:                []*bahn.Stop{koeln, siegburg},
+	}
+}
+
+func TestPollerSnapshot(t *testing.T) {
+	var p poller
+	t0 := time.Date(2018, 8, 2, 20, 10, 0, 0, time.UTC)
+	errPortal := errors.New("portal unreachable")
+
+	if s := p.snapshot(t0); s.Trip != nil || s.Status != nil || s.Stale || !s.Position.IsZero() {
+		t.Errorf("snapshot() before the first poll = %+v, want empty", s)
+	}
+
+	cases := []struct {
+		name string
+		// u is added before taking the snapshot at time t, if not nil.
+		u        *update
+		t        time.Time
+		age      time.Duration
+		distance float64
+	}{
+		{
+			name:     "fresh",
+			u:        &update{Time: t0, Trip: pollerTrip(10), Status: &bahn.Status{Speed: 120}},
+			t:        t0,
+			distance: 10,
+		},
+		{
+			name: "status failed",
+			u:    &update{Time: t0.Add(30 * time.Second), Trip: pollerTrip(11), StatusErr: errPortal},
+			t:    t0.Add(30 * time.Second),
+			// The status is as old as the last successful poll.
+			age:      30 * time.Second,
+			distance: 11,
+		},
+		{
+			name: "both failed",
+			u:    &update{Time: t0.Add(60 * time.Second), TripErr: errPortal, StatusErr: errPortal},
+			t:    t0.Add(60 * time.Second),
+			age:  60 * time.Second,
+			// 30 s at 120 km/h since the trip was received.
+			distance: 12,
+		},
+		{
+			name: "next stop reached",
+			t:    t0.Add(time.Hour),
+			age:  time.Hour,
+			// The position is not extrapolated beyond the next stop.
+			distance: 25,
+		},
+	}
+
+	for _, c := range cases {
+		if c.u != nil {
+			p.add(c.u)
+		}
+		s := p.snapshot(c.t)
+
+		if s.Age != c.age || s.Stale != (c.age > 0) {
+			t.Errorf("%s: Age, Stale = %v, %v, want %v, %v", c.name, s.Age, s.Stale, c.age, c.age > 0)
+		}
+		if s.Trip == nil || s.Status == nil {
+			t.Errorf("%s: snapshot() = %+v, want trip and status", c.name, s)
+			continue
+		}
+		if got := s.Trip.DistanceFromStart(); math.Abs(got-c.distance) > 1e-9 {
+			t.Errorf("%s: DistanceFromStart() = %g, want %g", c.name, got, c.distance)
+		}
+		if s.Position.IsZero() {
+			t.Errorf("%s: Position is unknown", c.name)
+		}
+	}
+
+	// Extrapolating doesn't modify the received trip.
+	if got := p.trip.DistanceFromLastStop; got != 11 {
+		t.Errorf("received trip was moved to %g km, want 11 km", got)
+	}
+}
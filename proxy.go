@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// cachedResponse is a raw response of the portal's API.
+type cachedResponse struct {
+	body     []byte
+	etag     string
+	received time.Time
+}
+
+// proxyCache is a sink that keeps the raw responses of the portal and serves
+// them at the portal's paths. This allows other tools, including other
+// instances of icestat using -portal, to use icestat as a caching proxy.
+type proxyCache struct {
+	interval time.Duration
+
+	mu        sync.RWMutex
+	responses map[string]*cachedResponse
+}
+
+func newProxyCache(interval time.Duration) *proxyCache {
+	return &proxyCache{
+		interval:  interval,
+		responses: make(map[string]*cachedResponse),
+	}
+}
+
+func (p *proxyCache) update(u *update) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if u.Trip != nil {
+		p.responses[bahn.TripInfoPath] = newCachedResponse(u.RawTrip, u.Time)
+	}
+	if u.Status != nil {
+		p.responses[bahn.StatusPath] = newCachedResponse(u.RawStatus, u.Time)
+	}
+
+	return nil
+}
+
+func (p *proxyCache) close() error {
+	return nil
+}
+
+func newCachedResponse(body []byte, received time.Time) *cachedResponse {
+	sum := sha1.Sum(body)
+	return &cachedResponse{
+		body:     body,
+		etag:     `"` + hex.EncodeToString(sum[:]) + `"`,
+		received: received,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (p *proxyCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p.mu.RLock()
+	res := p.responses[r.URL.Path]
+	p.mu.RUnlock()
+
+	if res == nil {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", p.interval.Seconds()))
+		http.Error(w, "no response received from the portal yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The response is fresh until the next poll is due.
+	maxAge := p.interval - time.Since(res.received)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("ETag", res.etag)
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	h.Set("Last-Modified", res.received.UTC().Format(http.TimeFormat))
+
+	if etagMatch(r.Header.Get("If-None-Match"), res.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(res.body)
+}
+
+// etagMatch returns true if the If-None-Match header value matches etag.
+func etagMatch(header, etag string) bool {
+	for _, field := range strings.Split(header, ",") {
+		field = strings.TrimPrefix(strings.TrimSpace(field), "W/")
+		if field == "*" || field == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+func TestETagMatch(t *testing.T) {
+	const etag = `"0123abcd"`
+
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"0123abcd"`, true},
+		{`W/"0123abcd"`, true},
+		{`"ffff"`, false},
+		{`"ffff", "0123abcd"`, true},
+		{`"ffff",W/"0123abcd"`, true},
+		{"*", true},
+		{`0123abcd`, false},
+		{`"0123abcd`, false},
+	}
+
+	for _, c := range cases {
+		if got := etagMatch(c.header, etag); got != c.want {
+			t.Errorf("etagMatch(%q, %q) = %v, want %v", c.header, etag, got, c.want)
+		}
+	}
+}
+
+func TestProxyCache(t *testing.T) {
+	p := newProxyCache(30 * time.Second)
+	serve := func(method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Nothing has been received yet.
+	rec := serve(http.MethodGet, bahn.StatusPath, "")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("GET before the first poll = %d, Retry-After %q, want %d, Retry-After 30",
+			rec.Code, rec.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	const body = `{"connection":true,"speed":160}`
+	p.update(&update{
+		Time:      time.Now(),
+		Status:    &bahn.Status{Connection: true, Speed: 160},
+		RawStatus: []byte(body),
+		TripErr:   &bahn.HTTPError{StatusCode: http.StatusBadGateway},
+	})
+
+	rec = serve(http.MethodGet, bahn.StatusPath, "")
+	if rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Fatalf("GET = %d %q, want %d %q", rec.Code, rec.Body, http.StatusOK, body)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("ETag = %q, Content-Type = %q, want an ETag and JSON", etag, rec.Header().Get("Content-Type"))
+	}
+	// The response is fresh until the next poll, i.e. for the interval minus
+	// the few microseconds since it was received.
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=29" && got != "public, max-age=30" {
+		t.Errorf("Cache-Control = %q, want a max-age of 30 s", got)
+	}
+
+	cases := []struct {
+		method, ifNoneMatch string
+		code                int
+		body                string
+	}{
+		{http.MethodGet, etag, http.StatusNotModified, ""},
+		{http.MethodGet, "W/" + etag, http.StatusNotModified, ""},
+		{http.MethodGet, `"stale"`, http.StatusOK, body},
+		{http.MethodHead, "", http.StatusOK, ""},
+		{http.MethodHead, etag, http.StatusNotModified, ""},
+	}
+	for _, c := range cases {
+		rec := serve(c.method, bahn.StatusPath, c.ifNoneMatch)
+		if rec.Code != c.code || rec.Body.String() != c.body {
+			t.Errorf("%s with If-None-Match %q = %d %q, want %d %q", c.method, c.ifNoneMatch, rec.Code, rec.Body, c.code, c.body)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("%s with If-None-Match %q: ETag = %q, want %q", c.method, c.ifNoneMatch, got, etag)
+		}
+	}
+
+	// The trip failed to load, so there is nothing to serve.
+	if rec := serve(http.MethodGet, bahn.TripInfoPath, ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s = %d, want %d", bahn.TripInfoPath, rec.Code, http.StatusServiceUnavailable)
+	}
+
+	rec = serve(http.MethodPost, bahn.StatusPath, "")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST = %d, Allow %q, want %d, Allow %q", rec.Code, rec.Header().Get("Allow"), http.StatusMethodNotAllowed, "GET, HEAD")
+	}
+}
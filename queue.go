@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// queueShutdownTimeout is the time queued items are still processed for
+// after icestat was asked to shut down.
+const queueShutdownTimeout = 10 * time.Second
+
+// backgroundQueue processes items in a separate goroutine, so that slow
+// consumers, e.g. an unreachable server, don't delay the poll loop. Items
+// are dropped while the queue is full.
+type backgroundQueue struct {
+	items   chan interface{}
+	process func(ctx context.Context, item interface{})
+	done    chan struct{}
+
+	// ctx is passed to process and cancelled if processing the remaining
+	// items on close takes too long.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newBackgroundQueue starts a goroutine calling process for each item added
+// to the queue, in order. At most size items are buffered.
+func newBackgroundQueue(size int, process func(ctx context.Context, item interface{})) *backgroundQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &backgroundQueue{
+		items:   make(chan interface{}, size),
+		process: process,
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	go q.run()
+	return q
+}
+
+func (q *backgroundQueue) run() {
+	defer close(q.done)
+
+	for item := range q.items {
+		if q.ctx.Err() != nil {
+			return
+		}
+		q.process(q.ctx, item)
+	}
+}
+
+// add queues item. It returns false if the queue is full and item was
+// dropped.
+func (q *backgroundQueue) add(item interface{}) bool {
+	select {
+	case q.items <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// close processes the queued items, giving up after timeout. The remaining
+// items are then dropped and the context passed to process is cancelled.
+// When close returns, process is not running and won't be called again.
+// close returns false if it gave up.
+func (q *backgroundQueue) close(timeout time.Duration) bool {
+	close(q.items)
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-q.done:
+		q.cancel()
+		return true
+	case <-t.C:
+		q.cancel()
+		<-q.done
+		return false
+	}
+}
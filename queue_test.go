@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackgroundQueue(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		processed []interface{}
+	)
+	q := newBackgroundQueue(10, func(_ context.Context, item interface{}) {
+		mu.Lock()
+		processed = append(processed, item)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 5; i++ {
+		if !q.add(i) {
+			t.Fatalf("add(%d) = false, want true", i)
+		}
+	}
+	if !q.close(time.Minute) {
+		t.Error("close() gave up")
+	}
+
+	if want := []interface{}{0, 1, 2, 3, 4}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed %v, want %v", processed, want)
+	}
+}
+
+func TestBackgroundQueueTimeout(t *testing.T) {
+	started := make(chan struct{}, 1)
+	var processed []interface{}
+	q := newBackgroundQueue(1, func(ctx context.Context, item interface{}) {
+		processed = append(processed, item)
+		started <- struct{}{}
+		// Blocks until close gives up.
+		<-ctx.Done()
+	})
+
+	q.add("first")
+	<-started
+	if !q.add("second") {
+		t.Fatal("add() = false, want true")
+	}
+	// The queue holds one item.
+	if q.add("third") {
+		t.Error("add() to a full queue = true, want false")
+	}
+
+	if q.close(10 * time.Millisecond) {
+		t.Error("close() = true, want false")
+	}
+	// After close returns, no further items are processed, so that sinks can
+	// safely disconnect.
+	if want := []interface{}{"first"}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed %v, want %v", processed, want)
+	}
+}
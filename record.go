@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// recordExt is the file name extension of recordings.
+const recordExt = ".jsonl"
+
+// record is a line of a recording: the portal's undecoded responses of a
+// single poll. Trip or Status is missing if retrieving it failed.
+type record struct {
+	Time   time.Time       `json:"time"`
+	Trip   json.RawMessage `json:"trip,omitempty"`
+	Status json.RawMessage `json:"status,omitempty"`
+}
+
+// recorder is a sink appending the portal's responses to a file per trip in
+// a directory, e.g. "2018-08-02_ICE521.jsonl". Recordings can be analyzed
+// with "icestat stats".
+type recorder struct {
+	dir string
+
+	name string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &recorder{dir: dir}, nil
+}
+
+// recordName returns the file name of the recording of trip, observed at t.
+func recordName(trip *bahn.Trip, t time.Time) string {
+	date := trip.Date
+	if !bahn.ValidTime(date) {
+		date = t
+	}
+	train := strings.NewReplacer("/", "", " ", "").Replace(trip.TrainType + trip.TrainID)
+	return date.Format("2006-01-02") + "_" + train + recordExt
+}
+
+func (r *recorder) update(u *update) error {
+	if u.Trip != nil {
+		if name := recordName(u.Trip, u.Time); name != r.name {
+			if err := r.close(); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			r.name, r.f, r.w = name, f, bufio.NewWriter(f)
+		}
+	}
+	if r.f == nil || (u.Trip == nil && u.Status == nil) {
+		// Recordings are named after the trip.
+		return nil
+	}
+
+	rec := record{Time: u.Time}
+	if u.Trip != nil {
+		rec.Trip = u.RawTrip
+	}
+	if u.Status != nil {
+		rec.Status = u.RawStatus
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	r.w.Write(data)
+	r.w.WriteByte('\n')
+	return r.w.Flush()
+}
+
+func (r *recorder) close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.name, r.f, r.w = "", nil, nil
+	return err
+}
+
+// readRecords reads a recording and calls fn for every record.
+func readRecords(rd io.Reader, fn func(*record) error) error {
+	s := bufio.NewScanner(rd)
+	// Trip responses are larger than bufio.Scanner's default limit.
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for s.Scan() {
+		var rec record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return err
+		}
+		if err := fn(&rec); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// recordedTrip is the final state of a recorded trip.
+type recordedTrip struct {
+	Trip *bahn.Trip
+	// End is the time of the last record.
+	End time.Time
+}
+
+// recordingPaths returns the recordings in dir, in chronological order, or
+// dir itself if it is a file.
+func recordingPaths(dir string) ([]string, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{dir}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+recordExt))
+	if err != nil {
+		return nil, err
+	}
+	// File names start with the date.
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// errNotRecorded is the error of a replayed update whose trip or status was
+// not recorded, because retrieving it failed.
+var errNotRecorded = errors.New("not recorded")
+
+// update decodes rec into an update, as if it had just been polled.
+func (rec *record) update() (*update, error) {
+	u := &update{
+		Time:      rec.Time,
+		RawTrip:   rec.Trip,
+		TripErr:   errNotRecorded,
+		RawStatus: rec.Status,
+		StatusErr: errNotRecorded,
+	}
+
+	if len(rec.Trip) != 0 {
+		var trip bahn.Trip
+		if err := json.Unmarshal(rec.Trip, &trip); err != nil {
+			return nil, err
+		}
+		u.Trip, u.TripErr = &trip, nil
+	}
+	if len(rec.Status) != 0 {
+		var status bahn.Status
+		if err := json.Unmarshal(rec.Status, &status); err != nil {
+			return nil, err
+		}
+		u.Status, u.StatusErr = &status, nil
+	}
+
+	return u, nil
+}
+
+// loadRecordings reads the recordings in dir, or the recording dir if it is
+// a file, and returns the last trip of each.
+func loadRecordings(dir string) ([]recordedTrip, error) {
+	paths, err := recordingPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var trips []recordedTrip
+	for _, path := range paths {
+		rt, err := loadRecording(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if rt.Trip != nil {
+			trips = append(trips, rt)
+		}
+	}
+
+	return trips, nil
+}
+
+func loadRecording(path string) (recordedTrip, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return recordedTrip{}, err
+	}
+	defer f.Close()
+
+	var rt recordedTrip
+	err = readRecords(f, func(rec *record) error {
+		rt.End = rec.Time
+		if len(rec.Trip) == 0 {
+			return nil
+		}
+
+		var trip bahn.Trip
+		if err := json.Unmarshal(rec.Trip, &trip); err != nil {
+			return err
+		}
+		rt.Trip = &trip
+		return nil
+	})
+
+	return rt, err
+}
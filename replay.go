@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+var (
+	replaySpeed float64
+
+	exportFormat string
+	exportOutput string
+)
+
+// exportFormats maps the formats supported by "icestat export" to their
+// encoders.
+var exportFormats = map[string]func(io.Writer, *bahn.Trip, *track) error{
+	"gpx":     writeGPX,
+	"geojson": writeGeoJSON,
+	"kml":     writeKML,
+}
+
+func replayFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&replaySpeed, "speed", 0, "Replay this many times faster than recorded, e.g. 60 to replay an hour in a minute. "+
+		"0 replays as fast as possible.")
+}
+
+func exportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&exportFormat, "format", "gpx", "Output format: \"gpx\", \"geojson\" or \"kml\".")
+	fs.StringVar(&exportOutput, "o", "", "File to write to. Defaults to stdout.")
+}
+
+// readRecordings calls fn for every record in the recordings at paths, which
+// may be files or directories.
+func readRecordings(paths []string, fn func(*record) error) error {
+	for _, arg := range paths {
+		files, err := recordingPaths(arg)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range files {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			err = readRecords(f, fn)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runReplay implements the "replay" command: it passes the updates of
+// recordings through the same pipeline as "watch", e.g. to try out alarms or
+// the dashboard.
+func runReplay(fs *flag.FlagSet) int {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := setupDestinations(); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	stats := newSummary(summaryMarkdown, summaryJSON)
+	outputs, err := newOutputs()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	outputs = append(sinks{stats}, outputs...)
+	defer outputs.close()
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
+
+	dumpCh := dumpChannel()
+	dump := func() {
+		if err := stats.dump(os.Stderr); err != nil {
+			log.Println(err)
+		}
+	}
+
+	var (
+		p    poller
+		pl   = pipeline{outputs: outputs}
+		last time.Time
+	)
+	err = readRecordings(fs.Args(), func(rec *record) error {
+		u, err := rec.update()
+		if err != nil {
+			return err
+		}
+
+		if replaySpeed > 0 && !last.IsZero() && u.Time.After(last) {
+			wait := time.Duration(float64(u.Time.Sub(last)) / replaySpeed)
+			if err := sleep(ctx, wait, dumpCh, dump); err != nil {
+				return err
+			}
+		}
+		last = u.Time
+
+		if err := pl.validate(u); err != nil {
+			return err
+		}
+		p.add(u)
+		pl.process(u, p.snapshot(u.Time))
+		return ctx.Err()
+	})
+	if err != nil && err != context.Canceled {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// runExport implements the "export" command: it writes the track and stops of
+// a recorded trip in one of exportFormats.
+func runExport(fs *flag.FlagSet) int {
+	encode, ok := exportFormats[exportFormat]
+	if fs.NArg() != 1 || !ok {
+		fs.Usage()
+		return 2
+	}
+
+	trip, tr, err := loadTrack(fs.Arg(0))
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	write := func(w io.Writer) error {
+		return encode(w, trip, tr)
+	}
+	if exportOutput != "" {
+		err = writeFileAtomic(exportOutput, write)
+	} else {
+		bw := bufio.NewWriter(os.Stdout)
+		if err = write(bw); err == nil {
+			err = bw.Flush()
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// loadTrack returns the trip and track recorded at path, which may be a file
+// or a directory. Unrelated trips can't be drawn as one track, so it's an
+// error if the recording contains more than one trip.
+func loadTrack(path string) (*bahn.Trip, *track, error) {
+	var (
+		trip *bahn.Trip
+		tr   track
+	)
+	err := readRecordings([]string{path}, func(rec *record) error {
+		u, err := rec.update()
+		if err != nil {
+			return err
+		}
+		if u.Trip != nil {
+			if trip != nil && !sameTrip(trip, u.Trip) {
+				return fmt.Errorf("more than one trip recorded (%s and %s), export them one at a time", tripName(trip), tripName(u.Trip))
+			}
+			trip = u.Trip
+		}
+		if u.Status != nil {
+			tr.add(u.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return trip, &tr, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTrack(t *testing.T) {
+	const recording = "testdata/2018-08-02_ICE521.jsonl"
+
+	trip, _, err := loadTrack(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trip == nil || tripName(trip) != "ICE 521" {
+		t.Errorf("loadTrack() = %v, want ICE 521", trip)
+	}
+
+	dir, err := ioutil.TempDir("", "icestat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := strings.Replace(string(data), `"vzn":"521"`, `"vzn":"523"`, -1)
+	for name, data := range map[string]string{
+		"2018-08-02_ICE521.jsonl": string(data),
+		"2018-08-02_ICE523.jsonl": other,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unrelated trips aren't joined into one track.
+	if _, _, err := loadTrack(dir); err == nil || !strings.Contains(err.Error(), "more than one trip") {
+		t.Errorf("loadTrack() of two trips = %v, want error", err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// gpxTrackFile is the subset of a GPX document needed to load a route.
+type gpxTrackFile struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []struct {
+				Latitude  float64 `xml:"lat,attr"`
+				Longitude float64 `xml:"lon,attr"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// readGPXRoute reads the tracks of a GPX file. It returns the name of the
+// first track and the points of all tracks.
+func readGPXRoute(b []byte) (string, []bahn.Position, error) {
+	var doc gpxTrackFile
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return "", nil, err
+	}
+
+	var (
+		name   string
+		points []bahn.Position
+	)
+	for _, trk := range doc.Tracks {
+		if name == "" {
+			name = trk.Name
+		}
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				points = append(points, bahn.Position{Latitude: p.Latitude, Longitude: p.Longitude})
+			}
+		}
+	}
+
+	return name, points, nil
+}
+
+// readGeoJSONRoute reads the LineString and MultiLineString geometries of a
+// GeoJSON FeatureCollection, Feature or geometry.
+func readGeoJSONRoute(b []byte) ([]bahn.Position, error) {
+	var obj struct {
+		Type        string
+		Features    []json.RawMessage
+		Geometry    json.RawMessage
+		Coordinates json.RawMessage
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, err
+	}
+
+	var lines [][][]float64
+	switch obj.Type {
+	case "FeatureCollection":
+		var points []bahn.Position
+		for _, f := range obj.Features {
+			p, err := readGeoJSONRoute(f)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, p...)
+		}
+		return points, nil
+	case "Feature":
+		if len(obj.Geometry) == 0 || string(obj.Geometry) == "null" {
+			return nil, nil
+		}
+		return readGeoJSONRoute(obj.Geometry)
+	case "LineString":
+		var line [][]float64
+		if err := json.Unmarshal(obj.Coordinates, &line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	case "MultiLineString":
+		if err := json.Unmarshal(obj.Coordinates, &lines); err != nil {
+			return nil, err
+		}
+	}
+
+	var points []bahn.Position
+	for _, line := range lines {
+		for _, c := range line {
+			if len(c) < 2 {
+				return nil, fmt.Errorf("invalid GeoJSON position %v", c)
+			}
+			points = append(points, bahn.Position{Latitude: c[1], Longitude: c[0]})
+		}
+	}
+
+	return points, nil
+}
+
+// loadRoute reads a route from a GPX or GeoJSON file. It returns the name of
+// the GPX track, if any.
+func loadRoute(path string) (string, *bahn.Route, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		name   string
+		points []bahn.Position
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gpx":
+		name, points, err = readGPXRoute(b)
+	case ".geojson", ".json":
+		points, err = readGeoJSONRoute(b)
+	default:
+		return "", nil, fmt.Errorf("%s: unsupported route format, want .gpx or .geojson", path)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(points) < 2 {
+		return "", nil, fmt.Errorf("%s: route contains less than two points", path)
+	}
+
+	return name, bahn.NewRoute(points), nil
+}
+
+// routeSource provides the route geometry for a trip. It is either a single
+// GPX or GeoJSON file, or a directory of GPX files recorded with -gpx on
+// previous trips, in which case the longest track of the same train is used.
+type routeSource struct {
+	path   string
+	routes map[string]*bahn.Route
+}
+
+func newRouteSource(path string) *routeSource {
+	return &routeSource{
+		path:   path,
+		routes: make(map[string]*bahn.Route),
+	}
+}
+
+// route returns the route for trip, or nil if none is available.
+func (s *routeSource) route(trip *bahn.Trip) *bahn.Route {
+	name := tripName(trip)
+	if r, ok := s.routes[name]; ok {
+		return r
+	}
+
+	r, err := s.load(name)
+	if err != nil {
+		log.Println(err)
+	}
+	s.routes[name] = r
+	return r
+}
+
+func (s *routeSource) load(name string) (*bahn.Route, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		_, r, err := loadRoute(s.path)
+		return r, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.path, "*.gpx"))
+	if err != nil {
+		return nil, err
+	}
+
+	var best *bahn.Route
+	for _, f := range files {
+		trackName, r, err := loadRoute(f)
+		if err != nil || trackName != name {
+			continue
+		}
+		if best == nil || r.Length() > best.Length() {
+			best = r
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("%s: no recorded track of %s found", s.path, name)
+	}
+	return best, nil
+}
+
+// maxSnapOffset is the maximum distance, in kilometers, between a position
+// and the route for the position to be considered on the route.
+const maxSnapOffset = 2.0
+
+// routeDistance returns a function that computes the distance from the
+// train's position to a stop along r. If the position can't be snapped onto
+// the route, it falls back to the portal's distance information.
+func routeDistance(r *bahn.Route, trip *bahn.Trip, pos bahn.Position) func(*bahn.Stop) float64 {
+	fallback := trip.DistanceTo
+	if r == nil || pos.IsZero() {
+		return fallback
+	}
+
+	along, offset := r.Snap(pos)
+	if offset > maxSnapOffset {
+		return fallback
+	}
+
+	return func(s *bahn.Stop) float64 {
+		stopAlong, stopOffset := r.Snap(s.Station.Position())
+		if stopOffset > maxSnapOffset {
+			return fallback(s)
+		}
+		return stopAlong - along
+	}
+}
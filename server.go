@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// maxEvents is the number of events kept for the HTTP API.
+const maxEvents = 100
+
+// liveState holds the most recent data received by the poll loop, so it can
+// be served over HTTP. It is safe for concurrent use.
+type liveState struct {
+	mu      sync.RWMutex
+	trip    *bahn.Trip
+	status  *bahn.Status
+	track   track
+	updated time.Time
+
+	// tripTime and statusTime are the times trip and status were received.
+	tripTime, statusTime time.Time
+
+	// now is the time of the most recent update, successful or not. Ages
+	// and ETAs served by the API are relative to it rather than to the
+	// current time, so that they are right when replaying recordings.
+	now time.Time
+
+	// events holds the most recent events, oldest first.
+	events []event
+
+	// estimator interpolates the train's position between updates.
+	estimator bahn.Estimator
+
+	// changed is closed and replaced whenever the state is updated.
+	changed chan struct{}
+}
+
+// wait returns a channel that is closed on the next update.
+func (s *liveState) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+	return s.changed
+}
+
+func (s *liveState) update(u *update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+
+	s.now = u.Time
+	if u.tripChanged() {
+		s.track = track{}
+	}
+	if u.Trip != nil {
+		s.trip = u.Trip
+		s.tripTime = u.Time
+		s.updated = u.Time
+		s.estimator.UpdateTrip(u.Trip, u.Time)
+	}
+	if u.Status != nil {
+		s.status = u.Status
+		s.statusTime = u.Time
+		s.track.add(u.Status)
+		s.updated = u.Time
+		s.estimator.UpdateStatus(u.Status, u.Time)
+	}
+
+	s.events = append(s.events, u.Events...)
+	if n := len(s.events); n > maxEvents {
+		s.events = append([]event(nil), s.events[n-maxEvents:]...)
+	}
+}
+
+// snapshot returns the latest trip and a copy of the track.
+func (s *liveState) snapshot() (*bahn.Trip, *track) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tr := &track{
+		points: s.track.points[:len(s.track.points):len(s.track.points)],
+		starts: s.track.starts[:len(s.track.starts):len(s.track.starts)],
+	}
+	return s.trip, tr
+}
+
+// estimate returns the estimated position of the train at time t.
+func (s *liveState) estimate(t time.Time) *apiPosition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, ok := s.estimator.Position(t)
+	if !ok {
+		return nil
+	}
+
+	p := &apiPosition{
+		Time:      t,
+		Latitude:  pos.Latitude,
+		Longitude: pos.Longitude,
+	}
+	if s.status != nil {
+		p.Speed = s.status.Speed
+	}
+
+	if trip := s.estimator.Trip(t); trip != nil {
+		p.DistanceFromStart = trip.DistanceFromStart()
+		if next := trip.NextStop; next != nil {
+			p.NextStop = next.Station.ID
+			p.NextStopDistance = trip.DistanceTo(next)
+			if bahn.ValidTime(next.ActualArrival) {
+				p.NextStopETASeconds = next.ActualArrival.Sub(t).Seconds()
+			}
+		}
+	}
+
+	return p
+}
+
+// server is a sink serving the current state over HTTP.
+type server struct {
+	state liveState
+	mux   *http.ServeMux
+	srv   *http.Server
+
+	// quit is closed on shutdown to terminate long-running requests.
+	quit chan struct{}
+}
+
+func newServer(addr string) *server {
+	s := &server{
+		mux:  http.NewServeMux(),
+		quit: make(chan struct{}),
+	}
+	s.srv = &http.Server{
+		Addr:    addr,
+		Handler: s.mux,
+	}
+
+	s.mux.Handle("/route.geojson", s.exportHandler("application/geo+json", writeGeoJSON))
+	s.mux.Handle("/route.kml", s.exportHandler("application/vnd.google-earth.kml+xml", writeKML))
+	s.mux.Handle("/route.gpx", s.exportHandler("application/gpx+xml", writeGPX))
+	s.mux.Handle("/events", http.HandlerFunc(s.handleEvents))
+	s.mux.Handle("/v1/trip", http.HandlerFunc(s.handleAPITrip))
+	s.mux.Handle("/v1/status", http.HandlerFunc(s.handleAPIStatus))
+	s.mux.Handle("/v1/stops/", http.HandlerFunc(s.handleAPIStop))
+	s.mux.Handle("/v1/events", http.HandlerFunc(s.handleAPIEvents))
+	s.mux.Handle("/v1/position", http.HandlerFunc(s.handleAPIPosition))
+	s.mux.Handle("/", http.HandlerFunc(s.handleDashboard))
+
+	return s
+}
+
+// start opens the listening socket and serves HTTP requests in the background.
+func (s *server) start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Println(err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *server) update(u *update) error {
+	s.state.update(u)
+	return nil
+}
+
+// close shuts the server down, giving active requests a few seconds to complete.
+func (s *server) close() error {
+	close(s.quit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.srv.Shutdown(ctx)
+}
+
+// exportHandler returns a handler that encodes the current state with encode.
+func (s *server) exportHandler(contentType string, encode func(io.Writer, *bahn.Trip, *track) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trip, tr := s.state.snapshot()
+
+		var buf bytes.Buffer
+		if err := encode(&buf, trip, tr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		buf.WriteTo(w)
+	})
+}
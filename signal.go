@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// signalContext returns a context that is cancelled when one of
+// shutdownSignals is received. A second signal terminates the process
+// immediately.
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, shutdownSignals...)
+
+	go func() {
+		select {
+		case <-ch:
+			log.Println("shutting down, interrupt again to exit immediately")
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(ch)
+			return
+		}
+
+		<-ch
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
+
+// dumpChannel returns a channel that receives a value whenever the user
+// requests a dump of the current statistics. On platforms without SIGUSR1
+// the returned channel never receives.
+func dumpChannel() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	if len(dumpSignals) != 0 {
+		signal.Notify(ch, dumpSignals...)
+	}
+	return ch
+}
+
+// sleep waits for d to pass. It calls dump whenever a value is received on
+// dumpCh and returns early with the context's error if ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration, dumpCh <-chan os.Signal, dump func()) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			return nil
+		case <-dumpCh:
+			dump()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "os"
+
+// shutdownSignals are the signals that cause icestat to shut down gracefully.
+var shutdownSignals = []os.Signal{os.Interrupt}
+
+// dumpSignals is empty: this platform has no SIGUSR1.
+var dumpSignals []os.Signal
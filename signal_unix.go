@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals are the signals that cause icestat to shut down gracefully.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// dumpSignals are the signals that cause icestat to print the current statistics.
+var dumpSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// update holds the result of one iteration of the poll loop. Trip and Status
+// are nil if retrieving them failed; the corresponding error is set instead.
+// RawTrip and RawStatus hold the undecoded responses. Events holds the events
+// detected since the previous update.
+type update struct {
+	Time      time.Time
+	Trip      *bahn.Trip
+	RawTrip   []byte
+	TripErr   error
+	Status    *bahn.Status
+	RawStatus []byte
+	StatusErr error
+	Events    []event
+}
+
+// err returns the first error encountered while polling, if any.
+func (u *update) err() error {
+	if u.TripErr != nil {
+		return u.TripErr
+	}
+	return u.StatusErr
+}
+
+// tripChanged returns true if u is the first update of a new trip, e.g.
+// after the passenger changed trains.
+func (u *update) tripChanged() bool {
+	for _, e := range u.Events {
+		if e.Kind == eventTripChanged {
+			return true
+		}
+	}
+	return false
+}
+
+// sink is a consumer of updates, e.g. a file writer. Sinks are closed when
+// icestat shuts down, giving them a chance to flush their output.
+type sink interface {
+	update(u *update) error
+	close() error
+}
+
+// sinks is the list of sinks updates are dispatched to.
+type sinks []sink
+
+// update passes u to all sinks. Errors are logged but don't stop the dispatch.
+func (s sinks) update(u *update) {
+	for _, snk := range s {
+		if err := snk.update(u); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// close closes all sinks in reverse order of registration.
+func (s sinks) close() error {
+	var firstErr error
+	for i := len(s) - 1; i >= 0; i-- {
+		if err := s[i].close(); err != nil {
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// fileSink keeps track of the latest trip and the positions reported so far
+// and rewrites a file with this information on every update. The file is
+// replaced atomically, so readers never see a partially written document.
+type fileSink struct {
+	path   string
+	encode func(w io.Writer, trip *bahn.Trip, tr *track) error
+
+	trip  *bahn.Trip
+	track track
+}
+
+func newFileSink(path string, encode func(io.Writer, *bahn.Trip, *track) error) *fileSink {
+	return &fileSink{
+		path:   path,
+		encode: encode,
+	}
+}
+
+func (f *fileSink) update(u *update) error {
+	if u.tripChanged() {
+		f.track.split()
+	}
+	if u.Trip != nil {
+		f.trip = u.Trip
+	}
+	if u.Status != nil {
+		f.track.add(u.Status)
+	}
+	if u.Trip == nil && u.Status == nil {
+		return nil
+	}
+
+	return f.write()
+}
+
+func (f *fileSink) close() error {
+	if f.trip == nil && len(f.track.points) == 0 {
+		return nil
+	}
+	return f.write()
+}
+
+func (f *fileSink) write() error {
+	return writeFileAtomic(f.path, func(w io.Writer) error {
+		return f.encode(w, f.trip, &f.track)
+	})
+}
+
+// writeFileAtomic writes to a temporary file in the same directory as path
+// and renames it to path once write has succeeded.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	bw := bufio.NewWriter(tmp)
+	if err := write(bw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
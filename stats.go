@@ -0,0 +1,269 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// statsDimensions are the dimensions "icestat stats" groups arrivals by.
+var statsDimensions = []string{"train", "segment", "station", "weekday", "hour"}
+
+// punctualityThresholds are the delays for which the share of arrivals
+// delayed by at most that much is reported.
+var punctualityThresholds = []time.Duration{5 * time.Minute, 15 * time.Minute}
+
+// delaySamples collects the delays observed for one group, e.g. a station.
+type delaySamples struct {
+	Key    string
+	Delays []time.Duration
+	// Gained is the delay gained on a segment. Only set for segments.
+	Gained []time.Duration
+}
+
+// within returns the share of delays that are at most d.
+func (s *delaySamples) within(d time.Duration) float64 {
+	var n int
+	for _, delay := range s.Delays {
+		if delay <= d {
+			n++
+		}
+	}
+	return float64(n) / float64(len(s.Delays))
+}
+
+// punctualityStats holds the samples of all groups of each dimension.
+type punctualityStats struct {
+	Trips  int
+	groups map[string]map[string]*delaySamples
+}
+
+func newPunctualityStats() *punctualityStats {
+	return &punctualityStats{
+		groups: make(map[string]map[string]*delaySamples),
+	}
+}
+
+// group returns the samples of key in dimension dim, creating them if needed.
+func (ps *punctualityStats) group(dim, key string) *delaySamples {
+	g, ok := ps.groups[dim]
+	if !ok {
+		g = make(map[string]*delaySamples)
+		ps.groups[dim] = g
+	}
+	s, ok := g[key]
+	if !ok {
+		s = &delaySamples{Key: key}
+		g[key] = s
+	}
+	return s
+}
+
+// arrived returns true if the train arrived at stop before end, the time of
+// the last record.
+func arrived(stop *bahn.Stop, end time.Time) bool {
+	if stop.Status == bahn.StopCancelled || !bahn.ValidTime(stop.ScheduledArrival) || !bahn.ValidTime(stop.ActualArrival) {
+		return false
+	}
+	return stop.Passed || !stop.ActualArrival.After(end)
+}
+
+// departed returns true if the train departed from stop before end. The
+// origin of the trip has a departure but no arrival.
+func departed(stop *bahn.Stop, end time.Time) bool {
+	if stop.Status == bahn.StopCancelled || !bahn.ValidTime(stop.ScheduledDeparture) || !bahn.ValidTime(stop.ActualDeparture) {
+		return false
+	}
+	return stop.Passed || !stop.ActualDeparture.After(end)
+}
+
+// add adds the arrivals of a recorded trip.
+func (ps *punctualityStats) add(rt recordedTrip) {
+	ps.Trips++
+	trip := rt.Trip
+
+	// prev is the stop the train departed from last.
+	var prev *bahn.Stop
+	for _, stop := range trip.Stops {
+		if stop.Status == bahn.StopCancelled {
+			continue
+		}
+		if !arrived(stop, rt.End) {
+			prev = nil
+			if departed(stop, rt.End) {
+				prev = stop
+			}
+			continue
+		}
+
+		delay := stop.ActualArrival.Sub(stop.ScheduledArrival)
+		sched := stop.ScheduledArrival.Local()
+		// Weekdays are prefixed with their index, starting on Monday, so
+		// that they sort in order.
+		weekday := fmt.Sprintf("%d %s", (int(sched.Weekday())+6)%7, sched.Weekday())
+
+		for dim, key := range map[string]string{
+			"train":   tripName(trip),
+			"station": stop.Station.Name,
+			"weekday": weekday,
+			"hour":    fmt.Sprintf("%02d:00", sched.Hour()),
+		} {
+			g := ps.group(dim, key)
+			g.Delays = append(g.Delays, delay)
+		}
+
+		if prev != nil {
+			seg := ps.group("segment", prev.Station.Name+" → "+stop.Station.Name)
+			seg.Delays = append(seg.Delays, delay)
+			seg.Gained = append(seg.Gained, delay-prev.ActualDeparture.Sub(prev.ScheduledDeparture))
+		}
+
+		prev = nil
+		if departed(stop, rt.End) {
+			prev = stop
+		}
+	}
+}
+
+// sorted returns the groups of dim, ordered by key, with their delays sorted.
+func (ps *punctualityStats) sorted(dim string) []*delaySamples {
+	var res []*delaySamples
+	for _, s := range ps.groups[dim] {
+		sort.Slice(s.Delays, func(i, j int) bool { return s.Delays[i] < s.Delays[j] })
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+// percentile returns the p-th percentile, 0 ≤ p ≤ 1, of the sorted slice
+// data using the nearest-rank method.
+func percentile(data []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(data)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return data[i]
+}
+
+func mean(data []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range data {
+		sum += d
+	}
+	return sum / time.Duration(len(data))
+}
+
+// formatMinutes formats d as a number of minutes with one decimal.
+func formatMinutes(d time.Duration) string {
+	return fmt.Sprintf("%+.1f", d.Minutes())
+}
+
+// write writes a table per dimension in dims to w.
+func (ps *punctualityStats) write(w io.Writer, dims []string) error {
+	fmt.Fprintf(w, "recorded trips: %d\n", ps.Trips)
+
+	for _, dim := range dims {
+		groups := ps.sorted(dim)
+		if len(groups) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		header := []string{dim, "n"}
+		for _, t := range punctualityThresholds {
+			header = append(header, fmt.Sprintf("≤%.0fmin", t.Minutes()))
+		}
+		header = append(header, "mean", "p50", "p90")
+		if dim == "segment" {
+			header = append(header, "gained")
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+		for _, g := range groups {
+			key := g.Key
+			if dim == "weekday" {
+				key = key[2:]
+			}
+			row := []string{key, fmt.Sprint(len(g.Delays))}
+			for _, t := range punctualityThresholds {
+				row = append(row, fmt.Sprintf("%.0f%%", 100*g.within(t)))
+			}
+			row = append(row, formatMinutes(mean(g.Delays)),
+				formatMinutes(percentile(g.Delays, 0.5)), formatMinutes(percentile(g.Delays, 0.9)))
+			if dim == "segment" {
+				row = append(row, formatMinutes(mean(g.Gained)))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var statsBy string
+
+func statsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&statsBy, "by", strings.Join(statsDimensions, ","), "Comma separated list of dimensions to group arrivals by.")
+}
+
+// runStats implements the "stats" command: it reports the punctuality of the
+// trips recorded with "record" or -record.
+func runStats(fs *flag.FlagSet) int {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var dims []string
+	for _, dim := range strings.Split(statsBy, ",") {
+		dim = strings.TrimSpace(dim)
+		if !contains(statsDimensions, dim) {
+			log.Printf("unknown dimension %q, want one of %s", dim, strings.Join(statsDimensions, ", "))
+			return 2
+		}
+		dims = append(dims, dim)
+	}
+
+	ps := newPunctualityStats()
+	for _, path := range fs.Args() {
+		trips, err := loadRecordings(path)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		for _, rt := range trips {
+			ps.add(rt)
+		}
+	}
+
+	if err := ps.write(os.Stdout, dims); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
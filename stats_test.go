@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPunctualityStats(t *testing.T) {
+	// The fixture's times are in UTC.
+	defer func(saved *time.Location) { time.Local = saved }(time.Local)
+	time.Local = time.UTC
+
+	// The last record of the fixture is from 21:50. By then, the train
+	// arrived at Siegburg/Bonn (+3), Montabaur (+10) and Frankfurt Airport
+	// (+20), but not at Frankfurt (Main) Hbf.
+	trips, err := loadRecordings("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trips) != 1 {
+		t.Fatalf("loadRecordings() returned %d trips, want 1", len(trips))
+	}
+
+	ps := newPunctualityStats()
+	ps.add(trips[0])
+
+	cases := []struct {
+		dim, key          string
+		n                 int
+		within5, within15 float64
+		mean, p50, p90    time.Duration
+		gained            time.Duration
+	}{
+		{"train", "ICE 521", 3, 1.0 / 3, 2.0 / 3, 11 * time.Minute, 10 * time.Minute, 20 * time.Minute, 0},
+		{"station", "Montabaur", 1, 0, 1, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute, 0},
+		{"weekday", "3 Thursday", 3, 1.0 / 3, 2.0 / 3, 11 * time.Minute, 10 * time.Minute, 20 * time.Minute, 0},
+		{"hour", "20:00", 2, 0.5, 1, 390 * time.Second, 3 * time.Minute, 10 * time.Minute, 0},
+		{"hour", "21:00", 1, 0, 0, 20 * time.Minute, 20 * time.Minute, 20 * time.Minute, 0},
+		// The origin has no arrival, but its departure delay counts.
+		{"segment", "Köln Hbf → Siegburg/Bonn", 1, 1, 1, 3 * time.Minute, 3 * time.Minute, 3 * time.Minute, time.Minute},
+		{"segment", "Siegburg/Bonn → Montabaur", 1, 0, 1, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute, 7 * time.Minute},
+		{"segment", "Montabaur → Frankfurt (M) Flughafen Fernbf", 1, 0, 0, 20 * time.Minute, 20 * time.Minute, 20 * time.Minute, 10 * time.Minute},
+	}
+
+	for _, c := range cases {
+		var g *delaySamples
+		for _, s := range ps.sorted(c.dim) {
+			if s.Key == c.key {
+				g = s
+			}
+		}
+		if g == nil {
+			t.Errorf("%s %q: no such group", c.dim, c.key)
+			continue
+		}
+
+		if got := len(g.Delays); got != c.n {
+			t.Errorf("%s %q: n = %d, want %d", c.dim, c.key, got, c.n)
+			continue
+		}
+		if got := g.within(5 * time.Minute); got != c.within5 {
+			t.Errorf("%s %q: within(5m) = %g, want %g", c.dim, c.key, got, c.within5)
+		}
+		if got := g.within(15 * time.Minute); got != c.within15 {
+			t.Errorf("%s %q: within(15m) = %g, want %g", c.dim, c.key, got, c.within15)
+		}
+		if got := mean(g.Delays); got != c.mean {
+			t.Errorf("%s %q: mean = %v, want %v", c.dim, c.key, got, c.mean)
+		}
+		if got := percentile(g.Delays, 0.5); got != c.p50 {
+			t.Errorf("%s %q: p50 = %v, want %v", c.dim, c.key, got, c.p50)
+		}
+		if got := percentile(g.Delays, 0.9); got != c.p90 {
+			t.Errorf("%s %q: p90 = %v, want %v", c.dim, c.key, got, c.p90)
+		}
+		if c.dim == "segment" {
+			if got := mean(g.Gained); got != c.gained {
+				t.Errorf("%s %q: gained = %v, want %v", c.dim, c.key, got, c.gained)
+			}
+		}
+	}
+
+	if got := len(ps.sorted("segment")); got != 3 {
+		t.Errorf("%d segments, want 3", got)
+	}
+	if got := len(ps.sorted("station")); got != 3 {
+		t.Errorf("%d stations, want 3", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// runStops implements the "stops" command: it retrieves the trip once and
+// prints its stops with scheduled and actual times, delay and platform.
+func runStops(fs *flag.FlagSet) int {
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := signalContext(context.Background())
+	defer cancel()
+
+	u := newPoller().poll(ctx)
+	if u.Trip == nil {
+		log.Println(u.TripErr)
+		return 1
+	}
+
+	if err := writeStops(os.Stdout, u.Trip); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// writeStops writes a table of the stops of trip to w. Passed stops are
+// marked with "✓", the next stop with "→".
+func writeStops(w io.Writer, trip *bahn.Trip) error {
+	if len(trip.Stops) == 0 {
+		return errors.New("trip contains no stops")
+	}
+	fmt.Fprintf(w, "%s to %s\n\n", tripName(trip), trip.Stops[len(trip.Stops)-1].Station.Name)
+
+	clock := func(t time.Time) string {
+		if !bahn.ValidTime(t) {
+			return "-"
+		}
+		return formatClock(t)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tstation\tarrival\t\tdeparture\t\tdelay\tplatform\tkm\t")
+	for _, stop := range trip.Stops {
+		mark := ""
+		switch {
+		case stop.Passed:
+			mark = "✓"
+		case stop == trip.NextStop:
+			mark = "→"
+		}
+
+		delay := formatDelay(stop.Delay())
+		if stop.Status == bahn.StopCancelled {
+			delay = "cancelled"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f\t\n", mark, stop.Station.Name,
+			clock(stop.ScheduledArrival), clock(stop.ActualArrival),
+			clock(stop.ScheduledDeparture), clock(stop.ActualDeparture),
+			delay, stop.Platform, stop.DistanceFromStart)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// stationarySpeed is the speed, in km/h, below which the train is considered
+// to be standing still.
+const stationarySpeed = 1.0
+
+// span is a period of time, e.g. a connectivity outage.
+type span struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (s span) duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// summary accumulates information about the trip over the lifetime of the
+// process, so that a report can be printed on exit. If the passenger changes
+// trains, each train is a separate leg of the journey. It implements the
+// sink interface.
+type summary struct {
+	// speed is the distribution of speeds over the whole journey.
+	speed speedDistribution
+	// markdownPath and jsonPath are the optional files the report is written to on close.
+	markdownPath, jsonPath string
+
+	start, end time.Time
+	legs       []*legSummary
+
+	lastStatus     *bahn.Status
+	lastStatusTime time.Time
+	stationary     time.Duration
+
+	portalOutages []span
+	portalDown    bool
+	uplinkOutages []span
+	uplinkDown    bool
+}
+
+// legSummary accumulates information about a single train.
+type legSummary struct {
+	firstTrip *bahn.Trip
+	lastTrip  *bahn.Trip
+	delays    []delaySample
+}
+
+// delaySample is the delay at the destination observed at a point in time.
+type delaySample struct {
+	Time  time.Time
+	Delay time.Duration
+}
+
+// MarshalJSON implements the encoding/json.Marshaler interface. The delay is
+// encoded in seconds.
+func (d delaySample) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time         time.Time `json:"time"`
+		DelaySeconds float64   `json:"delay_seconds"`
+	}{d.Time, d.Delay.Seconds()})
+}
+
+func newSummary(markdownPath, jsonPath string) *summary {
+	return &summary{
+		markdownPath: markdownPath,
+		jsonPath:     jsonPath,
+	}
+}
+
+func (s *summary) update(u *update) error {
+	if u.Trip != nil {
+		s.addTrip(u.Time, u.Trip)
+	}
+	if u.Status != nil {
+		s.addStatus(u.Time, u.Status)
+	}
+	if u.err() != nil {
+		s.addError(u.Time)
+	}
+	return nil
+}
+
+// dump writes a human readable report of the current state to w.
+func (s *summary) dump(w io.Writer) error {
+	return s.report().writeText(w)
+}
+
+// close prints the report to stdout and writes it to the configured files.
+func (s *summary) close() error {
+	r := s.report()
+
+	fmt.Println()
+	if err := r.writeText(os.Stdout); err != nil {
+		return err
+	}
+
+	if s.markdownPath != "" {
+		if err := writeFileAtomic(s.markdownPath, r.writeMarkdown); err != nil {
+			return err
+		}
+	}
+
+	if s.jsonPath != "" {
+		if err := writeFileAtomic(s.jsonPath, r.writeJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *summary) touch(t time.Time) {
+	if s.start.IsZero() {
+		s.start = t
+	}
+	s.end = t
+}
+
+// addTrip records a successfully retrieved trip. A trip of another train
+// starts a new leg.
+func (s *summary) addTrip(t time.Time, trip *bahn.Trip) {
+	s.touch(t)
+	if n := len(s.legs); n == 0 || !sameTrip(s.legs[n-1].lastTrip, trip) {
+		s.legs = append(s.legs, &legSummary{firstTrip: trip})
+	}
+	leg := s.legs[len(s.legs)-1]
+	leg.lastTrip = trip
+
+	dst, err := finalDestination(trip)
+	if err != nil {
+		return
+	}
+	d := dst.Delay()
+	if n := len(leg.delays); n == 0 || leg.delays[n-1].Delay != d {
+		leg.delays = append(leg.delays, delaySample{Time: t, Delay: d})
+	}
+}
+
+// addStatus records a successfully retrieved status.
+func (s *summary) addStatus(t time.Time, st *bahn.Status) {
+	s.touch(t)
+	s.portalUp(t)
+	s.speed.add(st.Speed)
+
+	if s.lastStatus != nil && s.lastStatus.Speed < stationarySpeed && st.Speed < stationarySpeed {
+		s.stationary += t.Sub(s.lastStatusTime)
+	}
+	s.lastStatus = st
+	s.lastStatusTime = t
+
+	if !st.Connection && !s.uplinkDown {
+		s.uplinkDown = true
+		s.uplinkOutages = append(s.uplinkOutages, span{Start: t, End: t})
+	} else if st.Connection {
+		s.uplinkDown = false
+	}
+	if s.uplinkDown {
+		s.uplinkOutages[len(s.uplinkOutages)-1].End = t
+	}
+}
+
+// addError records a failed poll of the portal.
+func (s *summary) addError(t time.Time) {
+	s.touch(t)
+	if !s.portalDown {
+		s.portalDown = true
+		s.portalOutages = append(s.portalOutages, span{Start: t, End: t})
+	}
+	s.portalOutages[len(s.portalOutages)-1].End = t
+}
+
+func (s *summary) portalUp(t time.Time) {
+	if !s.portalDown {
+		return
+	}
+	s.portalDown = false
+	s.portalOutages[len(s.portalOutages)-1].End = t
+}
+
+// segmentReport describes the delay evolution between two consecutive stops.
+type segmentReport struct {
+	From           string        `json:"from"`
+	To             string        `json:"to"`
+	Distance       float64       `json:"distance_km"`
+	DepartureDelay time.Duration `json:"-"`
+	ArrivalDelay   time.Duration `json:"-"`
+	Passed         bool          `json:"passed"`
+}
+
+// MarshalJSON implements the encoding/json.Marshaler interface. Delays are
+// encoded in seconds.
+func (s segmentReport) MarshalJSON() ([]byte, error) {
+	type plain segmentReport
+	return json.Marshal(struct {
+		plain
+		DepartureDelaySeconds float64 `json:"departure_delay_seconds"`
+		ArrivalDelaySeconds   float64 `json:"arrival_delay_seconds"`
+	}{plain(s), s.DepartureDelay.Seconds(), s.ArrivalDelay.Seconds()})
+}
+
+// gained returns the delay accumulated on the segment.
+func (s segmentReport) gained() time.Duration {
+	return s.ArrivalDelay - s.DepartureDelay
+}
+
+type speedReport struct {
+	Max     float64 `json:"max_kmh"`
+	Average float64 `json:"avg_kmh"`
+	Median  float64 `json:"p50_kmh"`
+	P90     float64 `json:"p90_kmh"`
+}
+
+// report is the summary of a trip, suitable for printing or JSON encoding.
+type report struct {
+	Train            string          `json:"train"`
+	Date             time.Time       `json:"date"`
+	Start            time.Time       `json:"start"`
+	End              time.Time       `json:"end"`
+	Route            []string        `json:"route"`
+	Destination      string          `json:"destination"`
+	Arrived          bool            `json:"arrived"`
+	ScheduledArrival time.Time       `json:"scheduled_arrival"`
+	ActualArrival    time.Time       `json:"actual_arrival"`
+	Delays           []delaySample   `json:"delays"`
+	Segments         []segmentReport `json:"segments"`
+	Speed            *speedReport    `json:"speed,omitempty"`
+	Stationary       time.Duration   `json:"-"`
+	PortalOutages    []span          `json:"portal_outages"`
+	UplinkOutages    []span          `json:"uplink_outages"`
+
+	// Legs holds the reports of the individual trains if the passenger
+	// changed trains. The fields above then describe the whole journey.
+	Legs []*report `json:"legs,omitempty"`
+}
+
+// report creates a report from the data collected so far.
+func (s *summary) report() *report {
+	r := &report{
+		Start:         s.start,
+		End:           s.end,
+		Stationary:    s.stationary,
+		PortalOutages: s.portalOutages,
+		UplinkOutages: s.uplinkOutages,
+	}
+
+	if dist := s.speed; len(dist.data) != 0 {
+		r.Speed = &speedReport{
+			Max:     dist.max(),
+			Average: dist.average(),
+			Median:  dist.median(),
+			P90:     dist.percentile(90.0),
+		}
+	}
+
+	var trains []string
+	for _, l := range s.legs {
+		lr := l.report()
+		if lr.Train == "" {
+			continue
+		}
+		r.Legs = append(r.Legs, lr)
+
+		trains = append(trains, lr.Train)
+		if len(r.Route) != 0 && len(lr.Route) != 0 && r.Route[len(r.Route)-1] == lr.Route[0] {
+			r.Route = append(r.Route, lr.Route[1:]...)
+		} else {
+			r.Route = append(r.Route, lr.Route...)
+		}
+		r.Delays = append(r.Delays, lr.Delays...)
+		r.Segments = append(r.Segments, lr.Segments...)
+	}
+	if len(r.Legs) == 0 {
+		return r
+	}
+
+	first, last := r.Legs[0], r.Legs[len(r.Legs)-1]
+	r.Train = strings.Join(trains, " → ")
+	r.Date = first.Date
+	r.Destination = last.Destination
+	r.Arrived = last.Arrived
+	r.ScheduledArrival = last.ScheduledArrival
+	r.ActualArrival = last.ActualArrival
+	if len(r.Legs) == 1 {
+		r.Legs = nil
+	}
+
+	return r
+}
+
+// report creates the report of a single leg. Only the fields describing the
+// train are set.
+func (l *legSummary) report() *report {
+	r := &report{
+		Delays: l.delays,
+	}
+
+	trip := l.lastTrip
+	if trip == nil || len(trip.Stops) == 0 {
+		return r
+	}
+	r.Train = trip.TrainType + " " + trip.TrainID
+	r.Date = trip.Date
+
+	dst, err := finalDestination(trip)
+	if err != nil {
+		dst = trip.Stops[len(trip.Stops)-1]
+	}
+	r.Destination = dst.Station.Name
+	r.Arrived = dst.Passed
+	r.ScheduledArrival = dst.ScheduledArrival
+	r.ActualArrival = dst.ActualArrival
+
+	// The route starts where the passenger boarded or, if unknown, at the
+	// last stop the train passed when we started observing.
+	first := 0
+	if boarding := findBoarding(trip); boarding != nil {
+		first = stopIndex(trip, boarding.Station.ID)
+	} else if l.firstTrip.PreviousStop != nil {
+		first = stopIndex(trip, l.firstTrip.PreviousStop.Station.ID)
+	}
+	last := stopIndex(trip, dst.Station.ID)
+	if first < 0 || last < first {
+		first, last = 0, len(trip.Stops)-1
+	}
+
+	for i := first; i <= last; i++ {
+		r.Route = append(r.Route, trip.Stops[i].Station.Name)
+		if i == first {
+			continue
+		}
+
+		from, to := trip.Stops[i-1], trip.Stops[i]
+		r.Segments = append(r.Segments, segmentReport{
+			From:           from.Station.Name,
+			To:             to.Station.Name,
+			Distance:       to.DistanceFromLastStop,
+			DepartureDelay: from.ActualDeparture.Sub(from.ScheduledDeparture),
+			ArrivalDelay:   to.ActualArrival.Sub(to.ScheduledArrival),
+			Passed:         to.Passed,
+		})
+	}
+
+	return r
+}
+
+func stopIndex(trip *bahn.Trip, evaNr string) int {
+	for i, s := range trip.Stops {
+		if s.Station.ID == evaNr {
+			return i
+		}
+	}
+	return -1
+}
+
+// stopByID returns the stop of trip with the given EVA number or nil.
+func stopByID(trip *bahn.Trip, evaNr string) *bahn.Stop {
+	if i := stopIndex(trip, evaNr); i >= 0 {
+		return trip.Stops[i]
+	}
+	return nil
+}
+
+func totalDuration(spans []span) time.Duration {
+	var d time.Duration
+	for _, s := range spans {
+		d += s.duration()
+	}
+	return d
+}
+
+func formatDelay(d time.Duration) string {
+	return fmt.Sprintf("%+.0f min", d.Minutes())
+}
+
+func formatClock(t time.Time) string {
+	return t.Local().Format("15:04")
+}
+
+func (r *report) arrivalLabel() string {
+	if r.Arrived {
+		return "actual"
+	}
+	return "expected"
+}
+
+func (r *report) delayEvolution() string {
+	if len(r.Delays) == 0 {
+		return "n/a"
+	}
+
+	var min, max time.Duration
+	for i, d := range r.Delays {
+		if i == 0 || d.Delay < min {
+			min = d.Delay
+		}
+		if i == 0 || d.Delay > max {
+			max = d.Delay
+		}
+	}
+
+	return fmt.Sprintf("%s → %s (min %s, max %s)",
+		formatDelay(r.Delays[0].Delay), formatDelay(r.Delays[len(r.Delays)-1].Delay),
+		formatDelay(min), formatDelay(max))
+}
+
+func (r *report) speedString() string {
+	if r.Speed == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.0f/%.0f/%.0f/%.0f [km/h] (max/avg/p50/p90)",
+		r.Speed.Max, r.Speed.Average, r.Speed.Median, r.Speed.P90)
+}
+
+func outageString(spans []span) string {
+	return fmt.Sprintf("%d (%s total)", len(spans), formatDuration(totalDuration(spans)))
+}
+
+// writeText writes a human readable version of r to w.
+func (r *report) writeText(w io.Writer) error {
+	if r.Train == "" {
+		_, err := fmt.Fprintln(w, "no trip information received")
+		return err
+	}
+
+	fmt.Fprintf(w, "%s on %s, observed %s–%s\n", r.Train, r.Date.Format("2006-01-02"),
+		formatClock(r.Start), formatClock(r.End))
+	fmt.Fprintf(w, "route:        %s\n", strings.Join(r.Route, " → "))
+	fmt.Fprintf(w, "arrival:      %s scheduled %s, %s %s (%s)\n", r.Destination,
+		formatClock(r.ScheduledArrival), r.arrivalLabel(), formatClock(r.ActualArrival),
+		formatDelay(r.ActualArrival.Sub(r.ScheduledArrival)))
+	for _, l := range r.Legs {
+		fmt.Fprintf(w, "  %s: %s scheduled %s, %s %s (%s)\n", l.Train, l.Destination,
+			formatClock(l.ScheduledArrival), l.arrivalLabel(), formatClock(l.ActualArrival),
+			formatDelay(l.ActualArrival.Sub(l.ScheduledArrival)))
+	}
+	fmt.Fprintf(w, "delay:        %s\n", r.delayEvolution())
+	fmt.Fprintf(w, "speed:        %s\n", r.speedString())
+	fmt.Fprintf(w, "stationary:   %s\n", formatDuration(r.Stationary))
+	fmt.Fprintf(w, "outages:      portal %s, uplink %s\n",
+		outageString(r.PortalOutages), outageString(r.UplinkOutages))
+	fmt.Fprintln(w, "segments:")
+	for _, s := range r.Segments {
+		fmt.Fprintf(w, "  %s → %s: %.0f km, delay %s → %s (%s)\n", s.From, s.To, s.Distance,
+			formatDelay(s.DepartureDelay), formatDelay(s.ArrivalDelay), formatDelay(s.gained()))
+	}
+
+	return nil
+}
+
+// writeMarkdown writes r formatted as a Markdown document to w.
+func (r *report) writeMarkdown(w io.Writer) error {
+	if r.Train == "" {
+		_, err := fmt.Fprint(w, "# Trip summary\n\nNo trip information received.\n")
+		return err
+	}
+
+	fmt.Fprintf(w, "# %s to %s, %s\n\n", r.Train, r.Destination, r.Date.Format("2006-01-02"))
+	fmt.Fprintf(w, "Observed from %s to %s.\n\n", formatClock(r.Start), formatClock(r.End))
+	fmt.Fprintf(w, "* **Route:** %s\n", strings.Join(r.Route, " → "))
+	fmt.Fprintf(w, "* **Arrival:** scheduled %s, %s %s (%s)\n",
+		formatClock(r.ScheduledArrival), r.arrivalLabel(), formatClock(r.ActualArrival),
+		formatDelay(r.ActualArrival.Sub(r.ScheduledArrival)))
+	fmt.Fprintf(w, "* **Delay:** %s\n", r.delayEvolution())
+	fmt.Fprintf(w, "* **Speed:** %s\n", r.speedString())
+	fmt.Fprintf(w, "* **Stationary:** %s\n", formatDuration(r.Stationary))
+	fmt.Fprintf(w, "* **Outages:** portal %s, uplink %s\n\n",
+		outageString(r.PortalOutages), outageString(r.UplinkOutages))
+
+	if len(r.Legs) != 0 {
+		fmt.Fprint(w, "## Legs\n\n")
+		fmt.Fprintln(w, "| Train | From | To | Scheduled | Arrival | Delay |")
+		fmt.Fprintln(w, "|-------|------|----|----------:|--------:|------:|")
+		for _, l := range r.Legs {
+			var from string
+			if len(l.Route) != 0 {
+				from = l.Route[0]
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n", l.Train, from, l.Destination,
+				formatClock(l.ScheduledArrival), formatClock(l.ActualArrival),
+				formatDelay(l.ActualArrival.Sub(l.ScheduledArrival)))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "## Segments\n\n")
+	fmt.Fprintln(w, "| From | To | Distance | Departure delay | Arrival delay | Gained |")
+	fmt.Fprintln(w, "|------|----|---------:|----------------:|--------------:|-------:|")
+	for _, s := range r.Segments {
+		fmt.Fprintf(w, "| %s | %s | %.0f km | %s | %s | %s |\n", s.From, s.To, s.Distance,
+			formatDelay(s.DepartureDelay), formatDelay(s.ArrivalDelay), formatDelay(s.gained()))
+	}
+
+	if len(r.Delays) != 0 {
+		fmt.Fprint(w, "\n## Delay at destination\n\n")
+		fmt.Fprintln(w, "| Time | Delay |")
+		fmt.Fprintln(w, "|------|------:|")
+		for _, d := range r.Delays {
+			fmt.Fprintf(w, "| %s | %s |\n", formatClock(d.Time), formatDelay(d.Delay))
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the encoding/json.Marshaler interface. The time spent
+// stationary is encoded in seconds.
+func (r *report) MarshalJSON() ([]byte, error) {
+	type plain report
+	return json.Marshal(struct {
+		*plain
+		StationarySeconds float64 `json:"stationary_seconds"`
+	}{(*plain)(r), r.Stationary.Seconds()})
+}
+
+// writeJSON writes r as a JSON object to w.
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// summaryStop describes a stop of a test trip. The train arrives and departs
+// at the scheduled time plus delay.
+type summaryStop struct {
+	name     string
+	at       string // scheduled time, "15:04"
+	delay    time.Duration
+	distance float64
+	passed   bool
+}
+
+// summaryTrip returns a trip of train on 2018-08-02 serving stops.
+func summaryTrip(train string, stops ...summaryStop) *bahn.Trip {
+	day := time.Date(2018, 8, 2, 0, 0, 0, 0, time.UTC)
+	f := strings.Fields(train)
+	trip := &bahn.Trip{TrainType: f[0], TrainID: f[1], Date: day}
+	for _, s := range stops {
+		t, err := time.Parse("15:04", s.at)
+		if err != nil {
+			panic(err)
+		}
+		sched := day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+		trip.Stops = append(trip.Stops, &bahn.Stop{
+			Station:              &bahn.Station{ID: s.name, Name: s.name},
+			DistanceFromLastStop: s.distance,
+			Passed:               s.passed,
+			ScheduledArrival:     sched,
+			ActualArrival:        sched.Add(s.delay),
+			ScheduledDeparture:   sched,
+			ActualDeparture:      sched.Add(s.delay),
+		})
+	}
+	return trip
+}
+
+// at returns the time hh:mm on 2018-08-02.
+func at(hhmm string) time.Time {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		panic(err)
+	}
+	return time.Date(2018, 8, 2, t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// testSummary returns a summary of a journey on ICE 521 from Köln Hbf to
+// Frankfurt Airport and on ICE 1001 from there to Mannheim. The portal is
+// unreachable from 20:11 to 20:13 and the uplink is down from 20:13 to
+// 20:15, while the train is standing still.
+func testSummary(markdownPath, jsonPath string) *summary {
+	const (
+		koeln     = "Köln Hbf"
+		siegburg  = "Siegburg/Bonn"
+		frankfurt = "Frankfurt (M) Flughafen Fernbf"
+		mannheim  = "Mannheim Hbf"
+	)
+	ice521 := func(frankfurtDelay time.Duration, arrived bool) *bahn.Trip {
+		return summaryTrip("ICE 521",
+			summaryStop{koeln, "20:00", 2 * time.Minute, 0, true},
+			summaryStop{siegburg, "20:20", 3 * time.Minute, 25, arrived},
+			summaryStop{frankfurt, "21:00", frankfurtDelay, 145, arrived})
+	}
+	ice1001 := summaryTrip("ICE 1001",
+		summaryStop{frankfurt, "21:30", 0, 0, true},
+		summaryStop{mannheim, "22:00", 4 * time.Minute, 77, false})
+	status := func(speed float64, connection bool) *bahn.Status {
+		return &bahn.Status{Speed: speed, Connection: connection}
+	}
+	errPortal := errors.New("portal unreachable")
+
+	s := newSummary(markdownPath, jsonPath)
+	for _, u := range []*update{
+		{Time: at("20:10"), Trip: ice521(5*time.Minute, false), Status: status(200, true)},
+		{Time: at("20:11"), TripErr: errPortal, StatusErr: errPortal},
+		{Time: at("20:12"), TripErr: errPortal, StatusErr: errPortal},
+		{Time: at("20:13"), Trip: ice521(7*time.Minute, false), Status: status(0, false)},
+		{Time: at("20:15"), Trip: ice521(7*time.Minute, false), Status: status(0, false)},
+		{Time: at("20:16"), Trip: ice521(7*time.Minute, false), Status: status(150, true)},
+		{Time: at("21:10"), Trip: ice521(7*time.Minute, true)},
+		{Time: at("21:40"), Trip: ice1001, Status: status(250, true)},
+	} {
+		s.update(u)
+	}
+	return s
+}
+
+func TestSummaryReport(t *testing.T) {
+	r := testSummary("", "").report()
+
+	if got, want := r.Train, "ICE 521 → ICE 1001"; got != want {
+		t.Errorf("Train = %q, want %q", got, want)
+	}
+	if !r.Start.Equal(at("20:10")) || !r.End.Equal(at("21:40")) {
+		t.Errorf("observed %v–%v, want 20:10–21:40", r.Start, r.End)
+	}
+	// The legs are joined at Frankfurt Airport.
+	wantRoute := []string{"Köln Hbf", "Siegburg/Bonn", "Frankfurt (M) Flughafen Fernbf", "Mannheim Hbf"}
+	if !reflect.DeepEqual(r.Route, wantRoute) {
+		t.Errorf("Route = %q, want %q", r.Route, wantRoute)
+	}
+	if r.Destination != "Mannheim Hbf" || r.Arrived || !r.ActualArrival.Equal(at("22:04")) {
+		t.Errorf("arrival = (%q, %v, %v), want (%q, false, 22:04)", r.Destination, r.Arrived, r.ActualArrival, "Mannheim Hbf")
+	}
+
+	if len(r.Legs) != 2 {
+		t.Fatalf("got %d legs, want 2", len(r.Legs))
+	}
+	if l := r.Legs[0]; l.Train != "ICE 521" || !l.Arrived || l.ActualArrival.Sub(l.ScheduledArrival) != 7*time.Minute {
+		t.Errorf("first leg = (%q, %v, %v), want (%q, true, 7m)", l.Train, l.Arrived, l.ActualArrival.Sub(l.ScheduledArrival), "ICE 521")
+	}
+
+	// Only changes of the delay at the leg's destination are recorded.
+	wantDelays := []delaySample{
+		{at("20:10"), 5 * time.Minute},
+		{at("20:13"), 7 * time.Minute},
+		{at("21:40"), 4 * time.Minute},
+	}
+	if !reflect.DeepEqual(r.Delays, wantDelays) {
+		t.Errorf("Delays = %v, want %v", r.Delays, wantDelays)
+	}
+
+	wantSegments := []segmentReport{
+		{"Köln Hbf", "Siegburg/Bonn", 25, 2 * time.Minute, 3 * time.Minute, true},
+		{"Siegburg/Bonn", "Frankfurt (M) Flughafen Fernbf", 145, 3 * time.Minute, 7 * time.Minute, true},
+		{"Frankfurt (M) Flughafen Fernbf", "Mannheim Hbf", 77, 0, 4 * time.Minute, false},
+	}
+	if !reflect.DeepEqual(r.Segments, wantSegments) {
+		t.Errorf("Segments = %+v, want %+v", r.Segments, wantSegments)
+	}
+
+	if got, want := r.Stationary, 2*time.Minute; got != want {
+		t.Errorf("Stationary = %v, want %v", got, want)
+	}
+	if want := []span{{at("20:11"), at("20:13")}}; !reflect.DeepEqual(r.PortalOutages, want) {
+		t.Errorf("PortalOutages = %v, want %v", r.PortalOutages, want)
+	}
+	if want := []span{{at("20:13"), at("20:15")}}; !reflect.DeepEqual(r.UplinkOutages, want) {
+		t.Errorf("UplinkOutages = %v, want %v", r.UplinkOutages, want)
+	}
+	if r.Speed == nil || r.Speed.Max != 250 {
+		t.Errorf("Speed = %+v, want max 250 km/h", r.Speed)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSummary("", "").report().writeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Train             string  `json:"train"`
+		StationarySeconds float64 `json:"stationary_seconds"`
+		Stationary        *int64  `json:"Stationary"`
+		Delays            []struct {
+			DelaySeconds float64 `json:"delay_seconds"`
+		} `json:"delays"`
+		Segments []struct {
+			From                  string  `json:"from"`
+			DepartureDelaySeconds float64 `json:"departure_delay_seconds"`
+			ArrivalDelaySeconds   float64 `json:"arrival_delay_seconds"`
+		} `json:"segments"`
+		PortalOutages []span `json:"portal_outages"`
+		Legs          []struct {
+			Train             string  `json:"train"`
+			StationarySeconds float64 `json:"stationary_seconds"`
+		} `json:"legs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v", buf.Bytes(), err)
+	}
+
+	if got.Train != "ICE 521 → ICE 1001" {
+		t.Errorf("train = %q, want %q", got.Train, "ICE 521 → ICE 1001")
+	}
+	if got.StationarySeconds != 120 || got.Stationary != nil {
+		t.Errorf("stationary_seconds = %g, Stationary = %v, want 120 and none", got.StationarySeconds, got.Stationary)
+	}
+	if len(got.Delays) != 3 || got.Delays[0].DelaySeconds != 300 {
+		t.Errorf("delays = %+v, want 3 samples starting with 300 s", got.Delays)
+	}
+	if len(got.Segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(got.Segments))
+	}
+	if s := got.Segments[1]; s.From != "Siegburg/Bonn" || s.DepartureDelaySeconds != 180 || s.ArrivalDelaySeconds != 420 {
+		t.Errorf("segments[1] = %+v, want from Siegburg/Bonn, 180 s to 420 s", s)
+	}
+	if len(got.PortalOutages) != 1 {
+		t.Errorf("portal_outages = %v, want one outage", got.PortalOutages)
+	}
+	if len(got.Legs) != 2 || got.Legs[1].Train != "ICE 1001" {
+		t.Errorf("legs = %+v, want ICE 521 and ICE 1001", got.Legs)
+	}
+}
+
+func TestSummaryMarkdown(t *testing.T) {
+	defer func(saved *time.Location) { time.Local = saved }(time.Local)
+	time.Local = time.UTC
+
+	var buf bytes.Buffer
+	if err := testSummary("", "").report().writeMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+
+	for _, want := range []string{
+		"# ICE 521 → ICE 1001 to Mannheim Hbf, 2018-08-02\n",
+		"* **Arrival:** scheduled 22:00, expected 22:04 (+4 min)\n",
+		"* **Stationary:** 0:02\n",
+		"* **Outages:** portal 1 (0:02 total), uplink 1 (0:02 total)\n",
+		"| ICE 521 | Köln Hbf | Frankfurt (M) Flughafen Fernbf | 21:00 | 21:07 | +7 min |\n",
+		"| ICE 1001 | Frankfurt (M) Flughafen Fernbf | Mannheim Hbf | 22:00 | 22:04 | +4 min |\n",
+		"| Siegburg/Bonn | Frankfurt (M) Flughafen Fernbf | 145 km | +3 min | +7 min | +4 min |\n",
+		"| 20:13 | +7 min |\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown does not contain %q:\n%s", want, md)
+		}
+	}
+
+	buf.Reset()
+	if err := new(summary).report().writeMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "# Trip summary\n\nNo trip information received.\n"; got != want {
+		t.Errorf("empty summary = %q, want %q", got, want)
+	}
+}
+
+func TestSummaryClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icestat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mdPath, jsonPath := filepath.Join(dir, "summary.md"), filepath.Join(dir, "summary.json")
+	if err := testSummary(mdPath, jsonPath).close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{mdPath, jsonPath} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Contains(data, []byte("ICE 1001")) {
+			t.Errorf("%s does not mention ICE 1001:\n%s", path, data)
+		}
+	}
+
+	// Only the summaries are left behind, no temporary files.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("%s contains %d files, want 2", dir, len(files))
+	}
+}
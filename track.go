@@ -0,0 +1,54 @@
+package main
+
+import "github.com/octo/icestat/bahn"
+
+// track is the sequence of positions reported by the status API. When the
+// passenger changes trains, a new segment is started, so that the positions of
+// different trains are not connected.
+type track struct {
+	points []bahn.Status
+	// starts holds the indexes of the points starting a segment, except
+	// for the first segment.
+	starts []int
+}
+
+// split starts a new segment with the next point.
+func (t *track) split() {
+	n := len(t.points)
+	if n == 0 || (len(t.starts) != 0 && t.starts[len(t.starts)-1] == n) {
+		return
+	}
+	t.starts = append(t.starts, n)
+}
+
+// segments returns the points of each segment.
+func (t *track) segments() [][]bahn.Status {
+	if len(t.points) == 0 {
+		return nil
+	}
+
+	var segs [][]bahn.Status
+	start := 0
+	for _, end := range t.starts {
+		segs = append(segs, t.points[start:end])
+		start = end
+	}
+	return append(segs, t.points[start:])
+}
+
+// add appends the position in s to the track. Samples without a position
+// fix and duplicates of the previous sample are ignored.
+func (t *track) add(s *bahn.Status) {
+	if s.Latitude == 0 && s.Longitude == 0 {
+		return
+	}
+
+	if n := len(t.points); n != 0 {
+		last := t.points[n-1]
+		if last.ServerTime.Equal(s.ServerTime) && last.Latitude == s.Latitude && last.Longitude == s.Longitude {
+			return
+		}
+	}
+
+	t.points = append(t.points, *s)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/octo/icestat/bahn"
+)
+
+// webhookQueueSize is the number of events buffered for delivery.
+const webhookQueueSize = 100
+
+// webhookTimeout is the timeout of a single delivery attempt.
+const webhookTimeout = 10 * time.Second
+
+// webhookRetryPolicy is the policy for retrying failed deliveries. Receivers
+// are usually reachable via the internet, so deliveries are retried for a
+// while to bridge gaps in the train's connectivity.
+var webhookRetryPolicy = bahn.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// webhook is a sink POSTing the events of each update as JSON to a list of
+// URLs. If a secret is set, the body is signed with HMAC-SHA256 and the
+// signature is sent in the X-Icestat-Signature header as "sha256=<hex>".
+// Events are delivered from a backgroundQueue.
+type webhook struct {
+	urls     []string
+	secret   []byte
+	minDelay time.Duration
+	client   *http.Client
+
+	// delays holds the delay last delivered for each stop, so that a delay
+	// growing slowly over many polls is delivered once it changed by at
+	// least minDelay.
+	delays map[string]time.Duration
+
+	queue *backgroundQueue
+}
+
+// newWebhook returns a webhook delivering to urls. Delay changes of less than
+// minDelay are not delivered.
+func newWebhook(urls []string, secret string, minDelay time.Duration) *webhook {
+	w := &webhook{
+		urls:     urls,
+		minDelay: minDelay,
+		client:   &http.Client{Timeout: webhookTimeout},
+		delays:   make(map[string]time.Duration),
+	}
+	if secret != "" {
+		w.secret = []byte(secret)
+	}
+
+	w.queue = newBackgroundQueue(webhookQueueSize, func(ctx context.Context, item interface{}) {
+		w.deliver(ctx, item.(event))
+	})
+	return w
+}
+
+func (w *webhook) update(u *update) error {
+	if u.tripChanged() {
+		w.delays = make(map[string]time.Duration)
+	}
+
+	for _, e := range u.Events {
+		if e.Kind == eventDelayChanged && !w.delayChanged(&e) {
+			continue
+		}
+
+		if !w.queue.add(e) {
+			log.Printf("webhook queue full, dropping %s event", e.Kind)
+		}
+	}
+	return nil
+}
+
+// close delivers the queued events, giving up after queueShutdownTimeout.
+func (w *webhook) close() error {
+	if !w.queue.close(queueShutdownTimeout) {
+		log.Println("webhook: giving up delivering queued events")
+	}
+	return nil
+}
+
+// deliver POSTs e to all URLs, retrying failed deliveries.
+func (w *webhook) deliver(ctx context.Context, e event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, url := range w.urls {
+		err := webhookRetryPolicy.Do(ctx, func() error {
+			return w.post(ctx, url, e.Kind, body)
+		})
+		if err != nil {
+			log.Printf("webhook: delivering %s event failed: %v", e.Kind, err)
+		}
+	}
+}
+
+func (w *webhook) post(ctx context.Context, url, kind string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "icestat")
+	req.Header.Set("X-Icestat-Event", kind)
+	if w.secret != nil {
+		req.Header.Set("X-Icestat-Signature", "sha256="+sign(w.secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &bahn.HTTPError{
+			Method:     http.MethodPost,
+			URL:        url,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+	}
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// delayChanged returns true if the delay reported by e, an
+// eventDelayChanged, differs from the delay last delivered for the stop by at
+// least minDelay. In that case, e is updated to report the change since the
+// last delivery.
+func (w *webhook) delayChanged(e *event) bool {
+	new, ok := parseMinutes(e.New)
+	if !ok {
+		return false
+	}
+	old, ok := w.delays[e.EvaNr]
+	if !ok {
+		// The delay before the first change is implicitly known.
+		if old, ok = parseMinutes(e.Old); !ok {
+			return false
+		}
+		w.delays[e.EvaNr] = old
+	}
+
+	change := new - old
+	if change < 0 {
+		change = -change
+	}
+	if change == 0 || change < w.minDelay {
+		return false
+	}
+
+	w.delays[e.EvaNr] = new
+	e.Old = fmt.Sprintf("%.0f", old.Minutes())
+	e.Message = fmt.Sprintf("delay at %s changed from %s to %s", e.Station, formatDelay(old), formatDelay(new))
+	return true
+}
+
+// parseMinutes parses a number of minutes as reported in events.
+func parseMinutes(s string) (time.Duration, bool) {
+	m, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(m * float64(time.Minute)), true
+}
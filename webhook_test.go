@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is a local HTTP server recording webhook deliveries. The
+// first failures requests are answered with 500 Internal Server Error.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	failures  int
+	attempts  int
+	events    []event
+	kinds     []string
+	signature []string
+	bodies    [][]byte
+}
+
+func newWebhookReceiver(failures int) *webhookReceiver {
+	r := &webhookReceiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.attempts++
+		if r.attempts <= r.failures {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+
+		var e event
+		if err := json.Unmarshal(body, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.events = append(r.events, e)
+		r.kinds = append(r.kinds, req.Header.Get("X-Icestat-Event"))
+		r.signature = append(r.signature, req.Header.Get("X-Icestat-Signature"))
+		r.bodies = append(r.bodies, body)
+	}))
+	return r
+}
+
+// fastWebhookRetries shortens the backoff between delivery attempts for the
+// duration of a test. The returned function restores the policy.
+func fastWebhookRetries() func() {
+	saved := webhookRetryPolicy
+	webhookRetryPolicy.InitialBackoff = time.Millisecond
+	webhookRetryPolicy.MaxBackoff = time.Millisecond
+	return func() {
+		webhookRetryPolicy = saved
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	defer fastWebhookRetries()()
+
+	r := newWebhookReceiver(2)
+	defer r.Close()
+
+	w := newWebhook([]string{r.URL}, "secret", 5*time.Minute)
+	want := event{
+		ID:      1,
+		Time:    time.Date(2018, 8, 2, 21, 28, 0, 0, time.UTC),
+		Kind:    eventDeparted,
+		Train:   "ICE 521",
+		EvaNr:   "8070003_00",
+		Station: "Frankfurt (M) Flughafen Fernbf",
+		Message: "departed from Frankfurt (M) Flughafen Fernbf",
+	}
+	w.update(&update{Events: []event{want}})
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two failed attempts are retried.
+	if got, want := r.attempts, 3; got != want {
+		t.Errorf("attempts = %d, want %d", got, want)
+	}
+	if len(r.events) != 1 {
+		t.Fatalf("received %d events, want 1", len(r.events))
+	}
+	if got := r.events[0]; got != want {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+	if got, want := r.kinds[0], eventDeparted; got != want {
+		t.Errorf("X-Icestat-Event = %q, want %q", got, want)
+	}
+	if got, want := r.signature[0], "sha256="+sign([]byte("secret"), r.bodies[0]); got != want {
+		t.Errorf("X-Icestat-Signature = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookMinDelay(t *testing.T) {
+	r := newWebhookReceiver(0)
+	defer r.Close()
+
+	// The delay grows by one minute per poll.
+	w := newWebhook([]string{r.URL}, "", 5*time.Minute)
+	for i := 1; i <= 20; i++ {
+		w.update(&update{Events: []event{{
+			ID:      i,
+			Kind:    eventDelayChanged,
+			EvaNr:   "8000261_00",
+			Station: "München Hbf",
+			Old:     fmt.Sprint(i - 1),
+			New:     fmt.Sprint(i),
+		}}})
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct{ old, new string }{
+		{"0", "5"},
+		{"5", "10"},
+		{"10", "15"},
+		{"15", "20"},
+	}
+	if len(r.events) != len(cases) {
+		t.Fatalf("received %d events, want %d: %+v", len(r.events), len(cases), r.events)
+	}
+	for i, c := range cases {
+		if got := r.events[i]; got.Old != c.old || got.New != c.new {
+			t.Errorf("event %d changed the delay from %s to %s, want from %s to %s", i, got.Old, got.New, c.old, c.new)
+		}
+	}
+	if got, want := r.events[0].Message, "delay at München Hbf changed from +0 min to +5 min"; got != want {
+		t.Errorf("Message = %q, want %q", got, want)
+	}
+}